@@ -6,17 +6,28 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"runtime"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli/v3"
 
 	"github.com/yoonhyunwoo/containeruntime/internal/container"
-	"github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
 )
 
+func init() {
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		// Container init keeps per-thread namespace state (such as the time
+		// namespace for children) until exec, so it must stay on the main thread.
+		runtime.LockOSThread()
+	}
+}
+
 func newRootCommand() *cli.Command {
 	createCommand := &cli.Command{
 		Name:      "create",
@@ -30,10 +41,11 @@ func newRootCommand() *cli.Command {
 			containerID := command.Args().Get(0)
 			bundlePath := command.Args().Get(1)
 
-			if err := cgroup.SetupCgroups(); err != nil {
-				return fmt.Errorf("main: failed to set up cgroups: %w", err)
+			opts := container.CreateOptions{
+				SystemdCgroup:    command.Bool("systemd-cgroup"),
+				CgroupBestEffort: command.Bool("cgroup-best-effort"),
 			}
-			if err := container.Create(containerID, bundlePath); err != nil {
+			if err := container.Create(containerID, bundlePath, opts); err != nil {
 				return fmt.Errorf("main: failed to create container: %w", err)
 			}
 
@@ -57,9 +69,101 @@ func newRootCommand() *cli.Command {
 				return fmt.Errorf("main: failed to delete container %s: %w", containerID, err)
 			}
 
-			if err := cgroup.CleanCgroups(); err != nil {
-				return fmt.Errorf("main: failed to clean up cgroups: %w", err)
+			return nil
+		},
+	}
+
+	eventsCommand := &cli.Command{
+		Name:      "events",
+		Usage:     "This command prints the OOM and resource limit events of a container as JSON lines until it is deleted. It requires cgroup v2.",
+		ArgsUsage: "<container-id>",
+		Action: func(ctx context.Context, command *cli.Command) error {
+			if command.Args().Len() != 1 {
+				return errors.New("main: container-id is required")
+			}
+
+			containerID := command.Args().First()
+			encoder := json.NewEncoder(os.Stdout)
+			err := container.Events(ctx, containerID, func(event container.Event) error {
+				return encoder.Encode(event)
+			})
+			if err != nil {
+				return fmt.Errorf("main: failed to watch events of container %s: %w", containerID, err)
+			}
+			return nil
+		},
+	}
+
+	reclaimCommand := &cli.Command{
+		Name:      "reclaim",
+		Usage:     "This command reclaims memory, such as page cache, from a container before it reaches its memory limits, and prints the result as JSON lines.",
+		ArgsUsage: "<container-id>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "amount",
+				Usage: "amount of memory to reclaim once, such as 256M",
+			},
+			&cli.UintFlag{
+				Name:  "target-working-set",
+				Usage: "reclaim periodically so that the working set makes up this percentage of the memory usage",
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Usage: "interval between reclaims with --target-working-set",
+				Value: time.Minute,
+			},
+			&cli.IntFlag{
+				Name:  "swappiness",
+				Usage: "balance between reclaiming anonymous (200) and file (0) memory",
+			},
+		},
+		Action: func(ctx context.Context, command *cli.Command) error {
+			if command.Args().Len() != 1 {
+				return errors.New("main: container-id is required")
+			}
+			if command.IsSet("amount") == command.IsSet("target-working-set") {
+				return errors.New("main: exactly one of --amount and --target-working-set is required")
+			}
+
+			containerID := command.Args().First()
+			var swappiness *int
+			if command.IsSet("swappiness") {
+				value := int(command.Int("swappiness"))
+				swappiness = &value
+			}
+			encoder := json.NewEncoder(os.Stdout)
+
+			if command.IsSet("target-working-set") {
+				err := container.ReclaimToWorkingSet(ctx, containerID, uint64(command.Uint("target-working-set")), command.Duration("interval"), swappiness, func(result container.ReclaimResult) error {
+					return encoder.Encode(result)
+				})
+				if err != nil {
+					return fmt.Errorf("main: failed to reclaim memory of container %s: %w", containerID, err)
+				}
+				return nil
+			}
+
+			amount, err := parseSize(command.String("amount"))
+			if err != nil {
+				return fmt.Errorf("main: invalid --amount: %w", err)
+			}
+			result, err := container.Reclaim(containerID, amount, swappiness)
+			if err != nil {
+				return fmt.Errorf("main: failed to reclaim memory of container %s: %w", containerID, err)
+			}
+			return encoder.Encode(result)
+		},
+	}
+
+	featuresCommand := &cli.Command{
+		Name:  "features",
+		Usage: "This command shows the features supported by the runtime in the OCI features JSON format.",
+		Action: func(_ context.Context, _ *cli.Command) error {
+			featuresBytes, err := json.MarshalIndent(container.Features(), "", "  ")
+			if err != nil {
+				return fmt.Errorf("main: failed to marshal features to JSON: %w", err)
 			}
+			_, _ = os.Stdout.Write(featuresBytes)
 			return nil
 		},
 	}
@@ -106,6 +210,36 @@ func newRootCommand() *cli.Command {
 		},
 	}
 
+	specCommand := &cli.Command{
+		Name:  "spec",
+		Usage: "This command writes a default config.json to the bundle directory.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "bundle",
+				Usage: "path to the bundle directory",
+				Value: ".",
+			},
+			&cli.StringFlag{
+				Name:  "rootfs",
+				Usage: "path to the root filesystem, relative to the bundle unless absolute",
+				Value: "rootfs",
+			},
+			&cli.BoolFlag{
+				Name:  "rootless",
+				Usage: "generate a configuration for a rootless container",
+			},
+		},
+		Action: func(_ context.Context, command *cli.Command) error {
+			spec := container.DefaultSpec(command.Bool("rootless"))
+			spec.Root.Path = command.String("rootfs")
+
+			if err := container.WriteSpec(command.String("bundle"), spec); err != nil {
+				return fmt.Errorf("main: failed to write spec: %w", err)
+			}
+			return nil
+		},
+	}
+
 	startCommand := &cli.Command{
 		Name:      "start",
 		Usage:     "This command starts a previously created container. It runs the user-specified program defined in the container's configuration.",
@@ -139,14 +273,6 @@ func newRootCommand() *cli.Command {
 				return fmt.Errorf("main: failed to get container state: %w", err)
 			}
 
-			err = container.Kill(containerID, 0)
-			if err != nil {
-				containerState.Status = specs.StateStopped
-				if saveErr := container.SetContainerState(containerID, containerState); saveErr != nil {
-					return fmt.Errorf("main: failed to save container state: %w", saveErr)
-				}
-			}
-
 			containerStateBytes, err := json.MarshalIndent(containerState, "", "  ")
 			if err != nil {
 				return fmt.Errorf("main: failed to marshal container state to JSON: %w", err)
@@ -156,23 +282,86 @@ func newRootCommand() *cli.Command {
 		},
 	}
 
+	validateCommand := &cli.Command{
+		Name:      "validate",
+		Usage:     "This command checks the configuration of a bundle and reports every problem found.",
+		ArgsUsage: "<path-to-bundle>",
+		Action: func(_ context.Context, command *cli.Command) error {
+			if command.Args().Len() != 1 {
+				return errors.New("main: path-to-bundle is required")
+			}
+
+			err := container.ValidateBundle(command.Args().First())
+			var validationErrs container.ValidationErrors
+			if errors.As(err, &validationErrs) {
+				for _, validationErr := range validationErrs {
+					fmt.Println(validationErr)
+				}
+				return fmt.Errorf("main: bundle has %d configuration problem(s)", len(validationErrs))
+			}
+			if err != nil {
+				return fmt.Errorf("main: failed to validate bundle: %w", err)
+			}
+			return nil
+		},
+	}
+
 	return &cli.Command{
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "systemd-cgroup",
+				Usage: "manage container cgroups as transient systemd scopes",
+			},
+			&cli.BoolFlag{
+				Name:  "cgroup-best-effort",
+				Usage: "skip, with a warning, resource limits whose cgroup controller is not available",
+			},
+		},
 		Commands: []*cli.Command{
 			createCommand,
 			deleteCommand,
+			eventsCommand,
+			featuresCommand,
 			initCommand,
 			killCommand,
+			reclaimCommand,
+			specCommand,
 			startCommand,
 			stateCommand,
+			validateCommand,
 		},
 	}
 }
 
-func main() {
-	if err := container.InitStateDir(); err != nil {
-		log.Fatal(err)
+// parseSize parses a size in bytes with an optional binary unit suffix, such
+// as "256M", "256MB", "256MiB" or "1G".
+func parseSize(size string) (uint64, error) {
+	number := strings.TrimSuffix(strings.TrimSuffix(size, "B"), "i")
+	shift := 0
+	if n := len(number); n > 0 {
+		switch number[n-1] {
+		case 'K', 'k':
+			shift = 10
+		case 'M':
+			shift = 20
+		case 'G':
+			shift = 30
+		case 'T':
+			shift = 40
+		}
+		if shift != 0 {
+			number = number[:n-1]
+		}
 	}
 
+	value, err := strconv.ParseUint(number, 10, 64)
+	if err != nil || value == 0 || value > math.MaxUint64>>shift {
+		return 0, fmt.Errorf("%q is not a positive size such as 256M", size)
+	}
+	return value << shift, nil
+}
+
+func main() {
 	rootCmd := newRootCommand()
 
 	if err := rootCmd.Run(context.Background(), os.Args); err != nil {
@@ -3,6 +3,7 @@ module github.com/yoonhyunwoo/containeruntime
 go 1.24.4
 
 require (
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/opencontainers/runtime-spec v1.2.1
 	github.com/urfave/cli/v3 v3.3.8
 	golang.org/x/sys v0.35.0
@@ -0,0 +1,203 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"syscall"
+	"unsafe"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// prctl(2) options and capset(2) ABI values, which the syscall package lacks.
+const (
+	prSetKeepCaps        = 8
+	prCapbsetRead        = 23
+	prCapbsetDrop        = 24
+	prSetNoNewPrivs      = 38
+	prCapAmbient         = 47
+	prCapAmbientRaise    = 2
+	prCapAmbientClearAll = 4
+
+	linuxCapabilityVersion3 = 0x20080522
+	linuxCapabilityU32s3    = 2
+)
+
+// capabilityNames lists the capabilities the runtime knows, indexed by number.
+var capabilityNames = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_DAC_READ_SEARCH",
+	"CAP_FOWNER",
+	"CAP_FSETID",
+	"CAP_KILL",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETPCAP",
+	"CAP_LINUX_IMMUTABLE",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_NET_BROADCAST",
+	"CAP_NET_ADMIN",
+	"CAP_NET_RAW",
+	"CAP_IPC_LOCK",
+	"CAP_IPC_OWNER",
+	"CAP_SYS_MODULE",
+	"CAP_SYS_RAWIO",
+	"CAP_SYS_CHROOT",
+	"CAP_SYS_PTRACE",
+	"CAP_SYS_PACCT",
+	"CAP_SYS_ADMIN",
+	"CAP_SYS_BOOT",
+	"CAP_SYS_NICE",
+	"CAP_SYS_RESOURCE",
+	"CAP_SYS_TIME",
+	"CAP_SYS_TTY_CONFIG",
+	"CAP_MKNOD",
+	"CAP_LEASE",
+	"CAP_AUDIT_WRITE",
+	"CAP_AUDIT_CONTROL",
+	"CAP_SETFCAP",
+	"CAP_MAC_OVERRIDE",
+	"CAP_MAC_ADMIN",
+	"CAP_SYSLOG",
+	"CAP_WAKE_ALARM",
+	"CAP_BLOCK_SUSPEND",
+	"CAP_AUDIT_READ",
+	"CAP_PERFMON",
+	"CAP_BPF",
+	"CAP_CHECKPOINT_RESTORE",
+}
+
+// capabilitySets holds the capability sets of a process, one bit per capability.
+type capabilitySets struct {
+	bounding    uint64
+	effective   uint64
+	permitted   uint64
+	inheritable uint64
+	ambient     uint64
+}
+
+// capabilityMask converts capability names to a bit mask.
+func capabilityMask(names []string) (uint64, error) {
+	var mask uint64
+	for _, name := range names {
+		c := slices.Index(capabilityNames, name)
+		if c < 0 {
+			return 0, fmt.Errorf("container: unknown capability %q", name)
+		}
+		mask |= 1 << c
+	}
+	return mask, nil
+}
+
+// parseCapabilities converts the capabilities of a spec to bit masks.
+func parseCapabilities(caps *specs.LinuxCapabilities) (capabilitySets, error) {
+	var sets capabilitySets
+	for _, set := range []struct {
+		names []string
+		mask  *uint64
+	}{
+		{caps.Bounding, &sets.bounding},
+		{caps.Effective, &sets.effective},
+		{caps.Permitted, &sets.permitted},
+		{caps.Inheritable, &sets.inheritable},
+		{caps.Ambient, &sets.ambient},
+	} {
+		mask, err := capabilityMask(set.names)
+		if err != nil {
+			return capabilitySets{}, err
+		}
+		*set.mask = mask
+	}
+	return sets, nil
+}
+
+// supportedCapabilities returns the mask of the known capabilities that the
+// running kernel supports.
+func supportedCapabilities() uint64 {
+	var mask uint64
+	for c := range capabilityNames {
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapbsetRead, uintptr(c), 0); errno == syscall.EINVAL {
+			break
+		}
+		mask |= 1 << c
+	}
+	return mask
+}
+
+// dropBoundingCapabilities removes the capabilities that a spec leaves out of
+// the bounding set. Dropping them needs CAP_SETPCAP, so this runs before the
+// process switches to its user. A nil caps keeps every capability.
+func dropBoundingCapabilities(caps *specs.LinuxCapabilities) error {
+	if caps == nil {
+		return nil
+	}
+	bounding, err := capabilityMask(caps.Bounding)
+	if err != nil {
+		return err
+	}
+	supported := supportedCapabilities()
+	for c := range capabilityNames {
+		bit := uint64(1) << c
+		if supported&bit == 0 || bounding&bit != 0 {
+			continue
+		}
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapbsetDrop, uintptr(c), 0); errno != 0 {
+			return fmt.Errorf("container: failed to drop %s from the bounding set: %w", capabilityNames[c], errno)
+		}
+	}
+	return nil
+}
+
+// applyCapabilities sets the effective, permitted, inheritable and ambient
+// capabilities of a spec on the calling thread, once dropBoundingCapabilities
+// has limited the bounding set. A nil caps keeps every capability, and
+// capabilities the kernel does not support are ignored. Capabilities are per
+// thread, so the calling goroutine must stay locked to its thread until exec.
+func applyCapabilities(caps *specs.LinuxCapabilities) error {
+	if caps == nil {
+		return nil
+	}
+	sets, err := parseCapabilities(caps)
+	if err != nil {
+		return err
+	}
+	supported := supportedCapabilities()
+
+	header := struct {
+		version uint32
+		pid     int32
+	}{version: linuxCapabilityVersion3}
+	var data [linuxCapabilityU32s3]struct {
+		effective   uint32
+		permitted   uint32
+		inheritable uint32
+	}
+	for i := range data {
+		shift := 32 * i
+		data[i].effective = uint32((sets.effective & supported) >> shift)
+		data[i].permitted = uint32((sets.permitted & supported) >> shift)
+		data[i].inheritable = uint32((sets.inheritable & supported) >> shift)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return fmt.Errorf("container: failed to set capabilities: %w", errno)
+	}
+
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0, 0, 0, 0); errno != 0 {
+		// Kernels before 4.3 have no ambient capabilities.
+		if sets.ambient == 0 && errors.Is(errno, syscall.EINVAL) {
+			return nil
+		}
+		return fmt.Errorf("container: failed to clear ambient capabilities: %w", errno)
+	}
+	for c := range capabilityNames {
+		if sets.ambient&supported&(1<<c) == 0 {
+			continue
+		}
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientRaise, uintptr(c), 0, 0, 0); errno != 0 {
+			return fmt.Errorf("container: failed to raise ambient capability %s: %w", capabilityNames[c], errno)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	sets, err := parseCapabilities(&specs.LinuxCapabilities{
+		Bounding:    []string{"CAP_CHOWN", "CAP_KILL", "CAP_CHECKPOINT_RESTORE"},
+		Effective:   []string{"CAP_KILL"},
+		Permitted:   []string{"CAP_KILL", "CAP_SYS_ADMIN"},
+		Inheritable: nil,
+		Ambient:     []string{"CAP_NET_BIND_SERVICE"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := capabilitySets{
+		bounding:  1<<0 | 1<<5 | 1<<40,
+		effective: 1 << 5,
+		permitted: 1<<5 | 1<<21,
+		ambient:   1 << 10,
+	}
+	if sets != want {
+		t.Errorf("parseCapabilities() = %+v, want %+v", sets, want)
+	}
+
+	if _, err := parseCapabilities(&specs.LinuxCapabilities{Effective: []string{"CAP_BOGUS"}}); err == nil {
+		t.Error("parseCapabilities with an unknown capability succeeded")
+	}
+}
+
+func TestSupportedCapabilities(t *testing.T) {
+	supported := supportedCapabilities()
+	// Every kernel the runtime supports knows the capabilities up to CAP_AUDIT_READ.
+	if want := uint64(1)<<38 - 1; supported&want != want {
+		t.Errorf("supportedCapabilities() = %#x, want at least %#x", supported, want)
+	}
+	if supported>>len(capabilityNames) != 0 {
+		t.Errorf("supportedCapabilities() = %#x reports unknown capabilities", supported)
+	}
+}
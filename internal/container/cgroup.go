@@ -0,0 +1,189 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	cgroupv1 "github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v1"
+	"github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+// CreateOptions holds the runtime-wide settings that affect container creation.
+type CreateOptions struct {
+	// SystemdCgroup manages the container cgroup as a transient systemd scope
+	// instead of writing to the cgroup filesystem directly.
+	SystemdCgroup bool
+	// CgroupBestEffort skips, with a warning, the resource limits whose cgroup
+	// controller is not available instead of failing.
+	CgroupBestEffort bool
+}
+
+// newCgroupManager builds the cgroup manager for a container and records in
+// its state where the cgroup lives. Hosts in hybrid or legacy mode get a
+// cgroup v1 manager.
+func newCgroupManager(containerID string, spec *specs.Spec, state *specs.State, opts CreateOptions) (cgroup.Manager, error) {
+	mode, err := cgroup.DetectMode()
+	if err != nil {
+		return nil, fmt.Errorf("container: failed to detect cgroup mode: %w", err)
+	}
+
+	var manager cgroup.Manager
+	switch {
+	case os.Geteuid() != 0:
+		// Limits a rootless container cannot enforce are skipped with a warning.
+		opts.CgroupBestEffort = true
+		manager, err = newRootlessCgroupManager(containerID, spec, mode, opts)
+	case mode == cgroup.Unified:
+		manager, err = newCgroupV2Manager(containerID, spec, state, opts)
+	default:
+		manager, err = newCgroupV1Manager(containerID, spec, mode, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manager.SetBestEffort(opts.CgroupBestEffort)
+	if spec.Linux.Resources != nil {
+		unified := spec.Linux.Resources.Unified
+		if mode == cgroup.Unified {
+			// cgroup v1 rejects unified values, so only v2 drops the subsystem keys.
+			unified = unifiedValues(unified)
+		}
+		manager.SetUnified(unified)
+	}
+	if path := manager.Path(); path != "" {
+		state.Annotations[cgroupPathAnnotation] = path
+	}
+	return manager, nil
+}
+
+// newRootlessCgroupManager places a rootless container in the cgroup subtree
+// delegated to the user. Without delegation, the container runs without a
+// cgroup of its own.
+func newRootlessCgroupManager(containerID string, spec *specs.Spec, mode cgroup.Mode, opts CreateOptions) (cgroup.Manager, error) {
+	if opts.SystemdCgroup {
+		return nil, errors.New("container: the systemd cgroup driver is not supported for rootless containers")
+	}
+	if mode != cgroup.Unified {
+		log.Printf("container: warning: rootless containers need cgroup v2, but the host is in %s mode; running without resource limits", mode)
+		return noCgroupManager{}, nil
+	}
+
+	delegated, err := cgroup.DelegatedCgroup()
+	if err != nil {
+		log.Printf("container: warning: running without resource limits: %v", err)
+		return noCgroupManager{}, nil
+	}
+	cgroupPath, err := cgroup.ResolveRootlessPath(spec.Linux.CgroupsPath, containerID, delegated)
+	if err != nil {
+		return nil, fmt.Errorf("container: failed to resolve cgroups path: %w", err)
+	}
+
+	subSystems, err := createCgroupSubSystems(spec)
+	if err != nil {
+		return nil, err
+	}
+	return cgroup.NewCgroupManager(cgroupPath, subSystems), nil
+}
+
+// noCgroupManager stands in for the cgroup manager of a rootless container
+// that cannot have a cgroup of its own. It enforces nothing.
+type noCgroupManager struct{}
+
+func (noCgroupManager) SetUnified(map[string]string) {}
+func (noCgroupManager) SetBestEffort(bool)           {}
+func (noCgroupManager) Setup() error                 { return nil }
+func (noCgroupManager) Path() string                 { return "" }
+func (noCgroupManager) AddProcess(int) error         { return nil }
+func (noCgroupManager) Kill() error                  { return nil }
+func (noCgroupManager) Clean() error                 { return nil }
+
+func (noCgroupManager) Stats() (*cgroup.Stats, error) {
+	return nil, errors.New("container: the container has no cgroup")
+}
+
+func newCgroupV2Manager(containerID string, spec *specs.Spec, state *specs.State, opts CreateOptions) (cgroup.Manager, error) {
+	subSystems, err := createCgroupSubSystems(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.SystemdCgroup {
+		systemdManager, err := cgroup.NewSystemdManager(spec.Linux.CgroupsPath, containerID, subSystems)
+		if err != nil {
+			return nil, fmt.Errorf("container: failed to resolve cgroups path: %w", err)
+		}
+		state.Annotations[systemdUnitAnnotation] = systemdManager.Unit()
+		return systemdManager, nil
+	}
+
+	cgroupPath, err := cgroup.ResolvePath(spec.Linux.CgroupsPath, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("container: failed to resolve cgroups path: %w", err)
+	}
+	return cgroup.NewCgroupManager(cgroupPath, subSystems), nil
+}
+
+func newCgroupV1Manager(containerID string, spec *specs.Spec, mode cgroup.Mode, opts CreateOptions) (cgroup.Manager, error) {
+	if opts.SystemdCgroup {
+		return nil, fmt.Errorf("container: the systemd cgroup driver requires cgroup v2, but the host is in %s mode", mode)
+	}
+
+	cgroupPath, err := cgroup.ResolvePath(spec.Linux.CgroupsPath, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("container: failed to resolve cgroups path: %w", err)
+	}
+	subSystems, err := createCgroupV1SubSystems(spec)
+	if err != nil {
+		return nil, err
+	}
+	manager, err := cgroupv1.NewManager(cgroupPath, subSystems)
+	if err != nil {
+		return nil, fmt.Errorf("container: failed to create cgroup v1 manager: %w", err)
+	}
+	return manager, nil
+}
+
+// loadCgroupManager rebuilds the cgroup manager of an existing container from
+// the annotations recorded in its state. It returns nil if none were recorded.
+func loadCgroupManager(state *specs.State) (cgroup.Manager, error) {
+	path, ok := state.Annotations[cgroupPathAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	mode, err := cgroup.DetectMode()
+	if err != nil {
+		return nil, fmt.Errorf("container: failed to detect cgroup mode: %w", err)
+	}
+	if mode != cgroup.Unified {
+		manager, err := cgroupv1.LoadManager(path)
+		if err != nil {
+			return nil, fmt.Errorf("container: failed to load cgroup of container %s: %w", state.ID, err)
+		}
+		return manager, nil
+	}
+
+	if unit, ok := state.Annotations[systemdUnitAnnotation]; ok {
+		slice := filepath.Base(filepath.Dir(path))
+		if filepath.Dir(path) == cgroup.DefaultRoot {
+			slice = "-.slice"
+		}
+		manager, err := cgroup.NewSystemdManager(slice+"::"+unit, state.ID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("container: failed to load cgroup of container %s: %w", state.ID, err)
+		}
+		return manager, nil
+	}
+
+	relPath, err := filepath.Rel(cgroup.DefaultRoot, path)
+	if err != nil {
+		return nil, fmt.Errorf("container: failed to load cgroup of container %s: %w", state.ID, err)
+	}
+	return cgroup.NewCgroupManager("/"+relPath, nil), nil
+}
@@ -0,0 +1,136 @@
+package container
+
+import (
+	"fmt"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	cgroupv1 "github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v1"
+	"github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+// createCgroupV1SubSystems translates OCI resources into cgroup v1
+// subsystems. Unlike cgroup v2, v1 takes most OCI values as they are.
+func createCgroupV1SubSystems(spec *specs.Spec) ([]cgroupv1.SubSystem, error) {
+	if spec.Linux == nil || spec.Linux.Resources == nil {
+		return nil, nil
+	}
+	resources := spec.Linux.Resources
+	var subSystems []cgroupv1.SubSystem
+
+	if mem := resources.Memory; mem != nil {
+		subSystems = append(subSystems, &cgroupv1.MemorySubSystem{
+			Limit:            nonZero(mem.Limit),
+			Reservation:      nonZero(mem.Reservation),
+			Swap:             nonZero(mem.Swap),
+			Swappiness:       mem.Swappiness,
+			DisableOOMKiller: mem.DisableOOMKiller,
+		})
+	}
+
+	if cpu := resources.CPU; cpu != nil {
+		cpuSubSys := &cgroupv1.CPUSubSystem{
+			RealtimeRuntime: cpu.RealtimeRuntime,
+			RealtimePeriod:  cpu.RealtimePeriod,
+		}
+		if cpu.Shares != nil && *cpu.Shares != 0 {
+			cpuSubSys.Shares = cpu.Shares
+		}
+		// A zero quota or period means unset; a non-positive quota means unlimited.
+		if cpu.Quota != nil && *cpu.Quota != 0 {
+			quota := *cpu.Quota
+			if quota < 0 {
+				quota = -1
+			}
+			cpuSubSys.Quota = &quota
+		}
+		if cpu.Period != nil && *cpu.Period != 0 {
+			cpuSubSys.Period = cpu.Period
+		}
+		subSystems = append(subSystems, cpuSubSys, &cgroupv1.CPUAcctSubSystem{})
+
+		if cpu.Cpus != "" || cpu.Mems != "" {
+			subSystems = append(subSystems, &cgroupv1.CpusetSubSystem{Cpus: cpu.Cpus, Mems: cpu.Mems})
+		}
+	}
+
+	// A zero pids limit is treated as unset, and any negative value as unlimited.
+	if resources.Pids != nil && resources.Pids.Limit != 0 {
+		limit := resources.Pids.Limit
+		if limit < 0 {
+			limit = -1
+		}
+		subSystems = append(subSystems, &cgroupv1.PidsSubSystem{Limit: &limit})
+	}
+
+	if resources.BlockIO != nil {
+		subSystems = append(subSystems, blkioSubSystem(resources.BlockIO))
+	}
+
+	if len(resources.Devices) > 0 {
+		devicesSubSys := &cgroupv1.DevicesSubSystem{}
+		for _, dev := range resources.Devices {
+			devicesSubSys.Rules = append(devicesSubSys.Rules, cgroupv1.DeviceRule{
+				Allow:  dev.Allow,
+				Type:   dev.Type,
+				Major:  dev.Major,
+				Minor:  dev.Minor,
+				Access: dev.Access,
+			})
+		}
+		subSystems = append(subSystems, devicesSubSys)
+	}
+
+	if len(resources.HugepageLimits) > 0 {
+		hugetlbSubSys := &cgroupv1.HugetlbSubSystem{Limits: make(map[string]uint64)}
+		for _, hugepage := range resources.HugepageLimits {
+			pageSize, err := cgroup.NormalizePageSize(hugepage.Pagesize)
+			if err != nil {
+				return nil, fmt.Errorf("container: invalid hugepage limit: %w", err)
+			}
+			hugetlbSubSys.Limits[pageSize] = hugepage.Limit
+		}
+		subSystems = append(subSystems, hugetlbSubSys)
+	}
+
+	return subSystems, nil
+}
+
+func blkioSubSystem(blockIO *specs.LinuxBlockIO) *cgroupv1.BlkioSubSystem {
+	blkioSubSys := &cgroupv1.BlkioSubSystem{}
+	if blockIO.Weight != nil && *blockIO.Weight != 0 {
+		blkioSubSys.Weight = blockIO.Weight
+	}
+	if blockIO.LeafWeight != nil && *blockIO.LeafWeight != 0 {
+		blkioSubSys.LeafWeight = blockIO.LeafWeight
+	}
+
+	for _, dev := range blockIO.WeightDevice {
+		if dev.Weight == nil || *dev.Weight == 0 {
+			continue
+		}
+		if blkioSubSys.WeightDevices == nil {
+			blkioSubSys.WeightDevices = make(map[cgroup.IODevice]uint16)
+		}
+		blkioSubSys.WeightDevices[cgroup.IODevice{Major: dev.Major, Minor: dev.Minor}] = *dev.Weight
+	}
+
+	throttles := []struct {
+		devices []specs.LinuxThrottleDevice
+		limits  *map[cgroup.IODevice]uint64
+	}{
+		{blockIO.ThrottleReadBpsDevice, &blkioSubSys.ThrottleReadBps},
+		{blockIO.ThrottleWriteBpsDevice, &blkioSubSys.ThrottleWriteBps},
+		{blockIO.ThrottleReadIOPSDevice, &blkioSubSys.ThrottleReadIOps},
+		{blockIO.ThrottleWriteIOPSDevice, &blkioSubSys.ThrottleWriteIOps},
+	}
+	for _, throttle := range throttles {
+		for _, dev := range throttle.devices {
+			if *throttle.limits == nil {
+				*throttle.limits = make(map[cgroup.IODevice]uint64)
+			}
+			(*throttle.limits)[cgroup.IODevice{Major: dev.Major, Minor: dev.Minor}] = dev.Rate
+		}
+	}
+	return blkioSubSys
+}
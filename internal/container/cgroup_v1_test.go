@@ -0,0 +1,31 @@
+package container
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	cgroupv1 "github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v1"
+)
+
+func TestCreateCgroupV1Hugetlb(t *testing.T) {
+	spec := &specs.Spec{Linux: &specs.Linux{Resources: &specs.LinuxResources{
+		HugepageLimits: []specs.LinuxHugepageLimit{{Pagesize: "2M", Limit: 1 << 21}},
+	}}}
+	subSystems, err := createCgroupV1SubSystems(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []cgroupv1.SubSystem{&cgroupv1.HugetlbSubSystem{Limits: map[string]uint64{"2MB": 1 << 21}}}
+	if !reflect.DeepEqual(subSystems, want) {
+		t.Errorf("subsystems = %v, want %v", subSystems, want)
+	}
+
+	for _, pageSize := range []string{"2XB", "17179869184G"} {
+		spec.Linux.Resources.HugepageLimits[0].Pagesize = pageSize
+		if subSystems, err := createCgroupV1SubSystems(spec); err == nil {
+			t.Errorf("page size %q converted to %v, want error", pageSize, subSystems)
+		}
+	}
+}
@@ -5,22 +5,54 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
-	"os/signal"
 	"path/filepath"
+	"runtime"
 	"syscall"
-	"time"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
 
 	"github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
 	"github.com/yoonhyunwoo/containeruntime/internal/linux/pty"
+	"github.com/yoonhyunwoo/containeruntime/internal/linux/timens"
 )
 
+// namespaceCloneFlags maps the namespaces the runtime supports to clone(2) flags.
+// clone() cannot place the child into a new time namespace, so init unshares it
+// and writes the offsets before exec instead. Init also unshares the cgroup
+// namespace itself, once it is in the container cgroup, so that the cgroup
+// becomes the root of the namespace even when init was moved into it after clone.
+var namespaceCloneFlags = map[specs.LinuxNamespaceType]uintptr{
+	specs.PIDNamespace:     syscall.CLONE_NEWPID,
+	specs.UTSNamespace:     syscall.CLONE_NEWUTS,
+	specs.MountNamespace:   syscall.CLONE_NEWNS,
+	specs.IPCNamespace:     syscall.CLONE_NEWIPC,
+	specs.NetworkNamespace: syscall.CLONE_NEWNET,
+	specs.UserNamespace:    syscall.CLONE_NEWUSER,
+	specs.CgroupNamespace:  0,
+	specs.TimeNamespace:    0,
+}
+
+// idMappings converts OCI user namespace mappings to those of SysProcAttr.
+func idMappings(mappings []specs.LinuxIDMapping) []syscall.SysProcIDMap {
+	idMaps := make([]syscall.SysProcIDMap, 0, len(mappings))
+	for _, m := range mappings {
+		idMaps = append(idMaps, syscall.SysProcIDMap{ContainerID: int(m.ContainerID), HostID: int(m.HostID), Size: int(m.Size)})
+	}
+	return idMaps
+}
+
 // Create initializes a new container with the given ID and root filesystem path.
-func Create(containerID, bundlePath string) error {
+func Create(containerID, bundlePath string, opts CreateOptions) error {
+	// The ID also names the container cgroup, so it is checked before anything is created.
+	dir, idErr := containerDir(containerID)
+	if idErr != nil {
+		return idErr
+	}
+
 	absBundlePath, absErr := filepath.Abs(bundlePath)
 	if absErr != nil {
 		return fmt.Errorf("container: failed to get absolute path for bundle: %w", absErr)
@@ -35,14 +67,30 @@ func Create(containerID, bundlePath string) error {
 	if specErr != nil {
 		return specErr
 	}
+	if validateErr := validateBundleSpec(bundlePath, spec); validateErr != nil {
+		return validateErr
+	}
+	if spec.Root != nil && !filepath.IsAbs(spec.Root.Path) {
+		spec.Root.Path = filepath.Join(bundlePath, spec.Root.Path)
+	}
+
+	state.Annotations = make(map[string]string)
+	cgroupManager, managerErr := newCgroupManager(containerID, spec, state, opts)
+	if managerErr != nil {
+		return managerErr
+	}
+
+	unlock, dirErr := createContainerDir(containerID)
+	if dirErr != nil {
+		return dirErr
+	}
+	defer unlock()
 
 	saveErr := saveState(state)
 	if saveErr != nil {
+		_ = deleteState(containerID)
 		return fmt.Errorf("container: failed to save initial state: %w", saveErr)
 	}
-	cgroupSubSystems := createCgroupSubSystems(spec)
-	cgroupManager := cgroup.NewCgroupManager(containerID, cgroupSubSystems)
-	_ = cgroupManager.Setup()
 	setupErr := cgroupManager.Setup()
 	if setupErr != nil {
 		return fmt.Errorf("container: failed to setup cgroups: %w", setupErr)
@@ -53,35 +101,9 @@ func Create(containerID, bundlePath string) error {
 		return fmt.Errorf("container: failed to get executable path: %w", exeErr)
 	}
 
-	// #nosec G204 -- self executable path is resolved from os.Executable and invoked intentionally.
-	cmd := exec.CommandContext(context.Background(), selfExe, append([]string{"init"}, spec.Process.Args...)...)
-
 	var cloneFlags uintptr
 	for _, ns := range spec.Linux.Namespaces {
-		switch ns.Type {
-		case specs.PIDNamespace:
-			cloneFlags |= syscall.CLONE_NEWPID
-		case specs.UTSNamespace:
-			cloneFlags |= syscall.CLONE_NEWUTS
-		case specs.MountNamespace:
-			cloneFlags |= syscall.CLONE_NEWNS
-		case specs.IPCNamespace:
-			cloneFlags |= syscall.CLONE_NEWIPC
-		case specs.NetworkNamespace:
-			cloneFlags |= syscall.CLONE_NEWNET
-		case specs.UserNamespace:
-			cloneFlags |= syscall.CLONE_NEWUSER
-		case specs.CgroupNamespace:
-			cloneFlags |= syscall.CLONE_NEWCGROUP
-		case specs.TimeNamespace:
-			cloneFlags |= syscall.CLONE_NEWTIME
-		}
-	}
-
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: cloneFlags,
-		Setsid:     spec.Process.Terminal,
-		Setctty:    spec.Process.Terminal,
+		cloneFlags |= namespaceCloneFlags[ns.Type]
 	}
 
 	r, w, pipeErr := os.Pipe()
@@ -90,37 +112,59 @@ func Create(containerID, bundlePath string) error {
 	}
 	defer w.Close()
 
-	cmd.ExtraFiles = []*os.File{r}
+	execFIFO, fifoErr := createExecFIFO(containerID)
+	if fifoErr != nil {
+		return fifoErr
+	}
+	defer execFIFO.Close()
+
+	logPath := filepath.Join(dir, logFilename)
+	logFile, logErr := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if logErr != nil {
+		return fmt.Errorf("container: failed to create log file: %w", logErr)
+	}
+	defer logFile.Close()
 
+	stdin, stdout, stderr := os.Stdin, os.Stdout, os.Stderr
 	if spec.Process.Terminal {
 		master, slave, ptyErr := pty.PtyPair()
 		if ptyErr != nil {
 			return fmt.Errorf("container: failed to create pty pair: %w", ptyErr)
 		}
-		cmd.Stdin = slave
-		cmd.Stdout = slave
-		cmd.Stderr = slave
-		cmd.SysProcAttr.Setctty = true
-		cmd.SysProcAttr.Setsid = true
-		state.Annotations = map[string]string{
-			"containeruntime/pty-master": fmt.Sprintf("%d", master.Fd()),
-			"containeruntime/pty-slave":  slave.Name(),
+		stdin, stdout, stderr = slave, slave, slave
+		state.Annotations["containeruntime/pty-master"] = fmt.Sprintf("%d", master.Fd())
+		state.Annotations["containeruntime/pty-slave"] = slave.Name()
+	}
+
+	newInitCmd := func() *exec.Cmd {
+		// #nosec G204 -- self executable path is resolved from os.Executable and invoked intentionally.
+		cmd := exec.CommandContext(context.Background(), selfExe, append([]string{"init"}, spec.Process.Args...)...)
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Cloneflags: cloneFlags,
+			Setsid:     spec.Process.Terminal,
+			Setctty:    spec.Process.Terminal,
 		}
-
-		startErr := cmd.Start()
-		if startErr != nil {
-			return fmt.Errorf("container: failed to start command: %w", startErr)
+		if hasNamespace(spec, specs.UserNamespace) {
+			cmd.SysProcAttr.UidMappings = idMappings(spec.Linux.UIDMappings)
+			cmd.SysProcAttr.GidMappings = idMappings(spec.Linux.GIDMappings)
+			// An unprivileged user may only write gid_map once setgroups(2)
+			// is denied in the new namespace.
+			cmd.SysProcAttr.GidMappingsEnableSetgroups = os.Geteuid() == 0
 		}
-
-		return errors.New("container: terminal mode is not supported yet")
+		cmd.ExtraFiles = []*os.File{r, execFIFO, logFile}
+		cmd.Stdin = stdin
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		return cmd
 	}
 
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	startErr := cmd.Start()
+	cmd, startErr := startInit(newInitCmd, cgroupManager)
 	if startErr != nil {
-		return fmt.Errorf("container: failed to start command: %w", startErr)
+		return startErr
+	}
+
+	if spec.Process.Terminal {
+		return errors.New("container: terminal mode is not supported yet")
 	}
 
 	encodeErr := json.NewEncoder(w).Encode(&spec)
@@ -139,20 +183,72 @@ func Create(containerID, bundlePath string) error {
 	return nil
 }
 
+// startInit starts the init process directly inside the container cgroup using
+// clone3 with CLONE_INTO_CGROUP. On kernels without it, with cgroup v1, or when
+// the cgroup is only created once it has a process (as with systemd), init is started
+// normally and added to the cgroup before it is sent the spec, so it never
+// runs container code outside its cgroup.
+func startInit(newInitCmd func() *exec.Cmd, cgroupManager cgroup.Manager) (*exec.Cmd, error) {
+	cgroupDir, openErr := os.Open(cgroupManager.Path())
+	if errors.Is(openErr, os.ErrNotExist) {
+		return startInitAndAdd(newInitCmd, cgroupManager)
+	}
+	if openErr != nil {
+		return nil, fmt.Errorf("container: failed to open container cgroup: %w", openErr)
+	}
+	defer cgroupDir.Close()
+
+	cmd := newInitCmd()
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(cgroupDir.Fd())
+
+	startErr := cmd.Start()
+	if startErr == nil {
+		return cmd, nil
+	}
+	// clone3 fails with EBADF for a cgroup that is not on the v2 hierarchy.
+	if !errors.Is(startErr, syscall.ENOSYS) && !errors.Is(startErr, syscall.E2BIG) && !errors.Is(startErr, syscall.EINVAL) && !errors.Is(startErr, syscall.EBADF) {
+		return nil, fmt.Errorf("container: failed to start command: %w", startErr)
+	}
+
+	return startInitAndAdd(newInitCmd, cgroupManager)
+}
+
+func startInitAndAdd(newInitCmd func() *exec.Cmd, cgroupManager cgroup.Manager) (*exec.Cmd, error) {
+	cmd := newInitCmd()
+	if startErr := cmd.Start(); startErr != nil {
+		return nil, fmt.Errorf("container: failed to start command: %w", startErr)
+	}
+	if addErr := cgroupManager.AddProcess(cmd.Process.Pid); addErr != nil {
+		_ = cmd.Process.Kill()
+		return nil, fmt.Errorf("container: failed to move init into its cgroup: %w", addErr)
+	}
+	return cmd, nil
+}
+
 // Start starts the container with the given ID.
 func Start(containerID string) error {
+	unlock, lockErr := lockContainer(containerID, syscall.LOCK_EX)
+	if lockErr != nil {
+		return lockErr
+	}
+	defer unlock()
+
 	state, loadErr := loadState(containerID)
 	if loadErr != nil {
 		return fmt.Errorf("container: failed to start container %s: %w", containerID, loadErr)
 	}
+	if state.Status != specs.StateCreated {
+		return fmt.Errorf("container: cannot start container %s in state %s", containerID, state.Status)
+	}
 
 	state.Status = specs.StateRunning
 
-	killErr := syscall.Kill(state.Pid, syscall.SIGCONT)
-	if killErr != nil {
+	releaseErr := releaseInit(containerID, state.Pid)
+	if releaseErr != nil {
 		state.Status = specs.StateStopped
 		_ = saveState(state)
-		return fmt.Errorf("container: failed to send SIGCONT to PID %d: %w", state.Pid, killErr)
+		return releaseErr
 	}
 
 	saveErr := saveState(state)
@@ -164,22 +260,46 @@ func Start(containerID string) error {
 	return nil
 }
 
-// State returns the current state of the container with the given ID.
+// State returns the current state of the container with the given ID. A
+// container whose init process is gone is marked as stopped.
 func State(containerID string) (*specs.State, error) {
+	unlock, err := lockContainer(containerID, syscall.LOCK_EX)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	state, err := loadState(containerID)
 	if err != nil {
 		return nil, err
 	}
+	// A container whose creation failed may have no process at all; kill(0, 0)
+	// would check the caller's own process group instead.
+	if state.Status != specs.StateStopped && (state.Pid <= 0 || syscall.Kill(state.Pid, 0) != nil) {
+		state.Status = specs.StateStopped
+		if err := saveState(state); err != nil {
+			return nil, fmt.Errorf("container: failed to update state for container %s: %w", containerID, err)
+		}
+	}
 	return state, nil
 }
 
 // Kill stops and removes the container with the given ID.
 func Kill(containerID string, sig syscall.Signal) error {
+	unlock, lockErr := lockContainer(containerID, syscall.LOCK_SH)
+	if lockErr != nil {
+		return lockErr
+	}
+	defer unlock()
+
 	state, loadErr := loadState(containerID)
 	if loadErr != nil {
 		return loadErr
 	}
 
+	if state.Pid <= 0 {
+		return fmt.Errorf("container: container %s has no process", containerID)
+	}
 	killErr := syscall.Kill(state.Pid, sig)
 	if killErr != nil {
 		return fmt.Errorf("container: failed to send signal %d to container %s with PID %d: %w", sig, containerID, state.Pid, killErr)
@@ -190,6 +310,9 @@ func Kill(containerID string, sig syscall.Signal) error {
 
 // Init initializes the container environment.
 func Init() {
+	logFile := os.NewFile(initLogFd, logFilename)
+	log.SetOutput(io.MultiWriter(os.Stderr, logFile))
+
 	pipe := os.NewFile(3, "pipe")
 	if pipe == nil {
 		log.Fatalf("container: failed to create pipe")
@@ -205,10 +328,20 @@ func Init() {
 		log.Printf("container: failed to close pipe: %v", closeErr)
 	}
 
-	ch := make(chan os.Signal, 1)
+	// Create has placed init in the container cgroup before sending the spec.
+	if hasNamespace(&spec, specs.CgroupNamespace) {
+		if err := syscall.Unshare(syscall.CLONE_NEWCGROUP); err != nil {
+			log.Fatalf("container: failed to unshare cgroup namespace: %v", err)
+		}
+	}
 
-	signal.Notify(ch, syscall.SIGCONT)
-	<-ch
+	if hasNamespace(&spec, specs.TimeNamespace) {
+		if err := timens.Unshare(spec.Linux.TimeOffsets); err != nil {
+			log.Fatalf("container: failed to set up time namespace: %v", err)
+		}
+	}
+
+	waitForStart()
 
 	if spec.Hostname != "" {
 		setHostErr := syscall.Sethostname([]byte(spec.Hostname))
@@ -227,6 +360,24 @@ func Init() {
 		log.Fatalf("container: failed to bind mount rootfs: %v", err)
 	}
 
+	// Mounts are set up before pivot_root, so that bind mount sources are
+	// resolved against the host.
+	for _, m := range spec.Mounts {
+		if err := mountEntry(rootfs, m); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, path := range spec.Linux.MaskedPaths {
+		if err := maskPath(rootfs, path); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, path := range spec.Linux.ReadonlyPaths {
+		if err := readonlyPath(rootfs, path); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	pivotDir := filepath.Join(rootfs, ".old_root")
 
 	if err := os.MkdirAll(pivotDir, 0o750); err != nil {
@@ -249,34 +400,87 @@ func Init() {
 		log.Fatalf("container: failed to remove old root directory: %v", err)
 	}
 
-	for _, m := range spec.Mounts {
-		if err := os.MkdirAll(m.Destination, 0o750); err != nil {
-			log.Fatalf("container: failed to create mount destination %s: %v", m.Destination, err)
+	if spec.Root.Readonly {
+		if err := remountReadonly("/"); err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		if err := syscall.Mount(m.Source, m.Destination, m.Type, 0, ""); err != nil {
-			log.Fatalf("container: failed to mount %s: %v", m.Destination, err)
+	// Capabilities and no_new_privs are per thread, so exec must happen on this one.
+	runtime.LockOSThread()
+	process := spec.Process
+	if err := setRlimits(process.Rlimits); err != nil {
+		log.Fatal(err)
+	}
+	if err := dropBoundingCapabilities(process.Capabilities); err != nil {
+		log.Fatal(err)
+	}
+	if err := setUser(process.User); err != nil {
+		log.Fatal(err)
+	}
+	if err := applyCapabilities(process.Capabilities); err != nil {
+		log.Fatal(err)
+	}
+	if process.NoNewPrivileges {
+		if err := setNoNewPrivileges(); err != nil {
+			log.Fatal(err)
 		}
 	}
 
+	if err := os.Chdir(process.Cwd); err != nil {
+		log.Fatalf("container: failed to change directory to %s: %v", process.Cwd, err)
+	}
+	executable, lookErr := lookPath(process.Args[0], process.Env)
+	if lookErr != nil {
+		log.Fatal(lookErr)
+	}
+
+	// The log file must not leak into the container process.
+	log.SetOutput(os.Stderr)
+	_ = logFile.Close()
+
 	// #nosec G204 -- process args are explicitly provided through OCI config and are expected runtime input.
-	if err := syscall.Exec(spec.Process.Args[0], spec.Process.Args, os.Environ()); err != nil {
-		log.Fatalf("container: failed to exec command %s: %v", spec.Process.Args[0], err)
+	if err := syscall.Exec(executable, process.Args, process.Env); err != nil {
+		log.Fatalf("container: failed to exec command %s: %v", process.Args[0], err)
 	}
 }
 
-// Delete removes the container with the given ID.
+// Delete removes the container with the given ID. Every process in the
+// container cgroup is killed, and the cgroup is removed once it is empty.
 func Delete(containerID string) error {
-	killErr := Kill(containerID, syscall.SIGKILL)
-	if killErr != nil {
-		return deleteState(containerID)
+	unlock, lockErr := lockContainer(containerID, syscall.LOCK_EX)
+	if lockErr != nil {
+		return lockErr
 	}
-	for range 5 {
-		time.Sleep(1 * time.Second)
-		checkErr := Kill(containerID, 0)
-		if checkErr != nil {
-			return deleteState(containerID)
+	defer unlock()
+
+	state, loadErr := loadState(containerID)
+	if loadErr != nil {
+		return loadErr
+	}
+
+	cgroupManager, managerErr := loadCgroupManager(state)
+	if managerErr != nil {
+		return managerErr
+	}
+	if cgroupManager == nil {
+		// Without a recorded cgroup, only the init process can be killed. A
+		// failed create leaves no process, and kill(0) would signal the
+		// caller's own process group.
+		if state.Pid > 0 {
+			killErr := syscall.Kill(state.Pid, syscall.SIGKILL)
+			if killErr != nil && !errors.Is(killErr, syscall.ESRCH) {
+				return fmt.Errorf("container: failed to kill container %s: %w", containerID, killErr)
+			}
 		}
+		return deleteState(containerID)
+	}
+
+	if killErr := cgroupManager.Kill(); killErr != nil {
+		return fmt.Errorf("container: failed to kill container %s: %w", containerID, killErr)
+	}
+	if cleanErr := cgroupManager.Clean(); cleanErr != nil {
+		return fmt.Errorf("container: failed to remove cgroup of container %s: %w", containerID, cleanErr)
 	}
-	return fmt.Errorf("container: the container %s is stil running: %w", containerID, killErr)
+	return deleteState(containerID)
 }
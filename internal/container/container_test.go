@@ -0,0 +1,240 @@
+package container
+
+import (
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func init() {
+	// Create starts init by re-executing the running binary, which here is the
+	// test binary, so it has to act as the runtime's init too.
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		runtime.LockOSThread()
+		Init()
+	}
+}
+
+// libraryDirs are searched for the shared libraries of the test binary.
+var libraryDirs = []string{"/lib64", "/lib/x86_64-linux-gnu", "/usr/lib/x86_64-linux-gnu", "/lib", "/usr/lib"}
+
+// copyFile copies the file at src to the same path below rootfs.
+func copyFile(t *testing.T, rootfs, src string) {
+	t.Helper()
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	dst := filepath.Join(rootfs, src)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testRootfs creates a root filesystem holding the test binary, with the
+// dynamic loader and libraries it needs, and returns the binary's path in it.
+func testRootfs(t *testing.T, rootfs string) string {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := elf.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		interp := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(interp, 0); err != nil {
+			t.Fatal(err)
+		}
+		copyFile(t, rootfs, string(interp[:len(interp)-1]))
+	}
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, lib := range libs {
+		found := false
+		for _, dir := range libraryDirs {
+			path := filepath.Join(dir, lib)
+			if _, err := os.Stat(filepath.Join(rootfs, path)); err == nil {
+				found = true
+				break
+			}
+			if _, err := os.Stat(path); err == nil {
+				copyFile(t, rootfs, path)
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Skipf("library %s of the test binary not found", lib)
+		}
+	}
+
+	copyFile(t, rootfs, exe)
+	return exe
+}
+
+// containerTestEnv is set in the environment of the container process of
+// TestCreateRootlessDefaultSpec.
+const containerTestEnv = "CONTAINERUNTIME_TEST_CONTAINER"
+
+// TestContainerProcess checks, from inside the container, that init applied
+// the default spec to the container process.
+func TestContainerProcess(t *testing.T) {
+	if os.Getenv(containerTestEnv) == "" {
+		t.Skip("runs inside the container of TestCreateRootlessDefaultSpec")
+	}
+	spec := DefaultSpec(true)
+
+	if _, ok := os.LookupEnv("CONTAINERUNTIME_TEST_HOST"); ok {
+		t.Error("the environment of the runtime leaked into the container")
+	}
+	if os.Getenv("TERM") != "xterm" {
+		t.Errorf("TERM = %q, want the value from process.env", os.Getenv("TERM"))
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wd, err := os.Getwd(); err != nil || wd != filepath.Dir(exe) {
+		t.Errorf("working directory = %q, %v, want process.cwd %q", wd, err, filepath.Dir(exe))
+	}
+
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil || rlimit.Max != 1024 {
+		t.Errorf("RLIMIT_NOFILE = %+v, %v, want a hard limit of 1024", rlimit, err)
+	}
+
+	// Init unshares the cgroup namespace once it is in the container cgroup,
+	// which makes that cgroup the root of every hierarchy.
+	cgroups, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Fields(string(cgroups)) {
+		if !strings.HasSuffix(line, ":/") {
+			t.Errorf("/proc/self/cgroup has %q, want every cgroup to be the namespace root", line)
+		}
+	}
+
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"NoNewPrivs:\t1\n", "CapEff:\t0000000020000420\n", "CapBnd:\t0000000020000420\n"} {
+		if !strings.Contains(string(status), want) {
+			t.Errorf("/proc/self/status does not contain %q:\n%s", want, status)
+		}
+	}
+
+	for _, path := range append([]string{"/"}, spec.Linux.ReadonlyPaths...) {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(path, &st); err != nil {
+			continue
+		}
+		if st.Flags&syscall.MS_RDONLY == 0 {
+			t.Errorf("%s is writable, want it read-only", path)
+		}
+	}
+	for _, path := range spec.Linux.MaskedPaths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			if entries, err := os.ReadDir(path); err != nil || len(entries) > 0 {
+				t.Errorf("masked directory %s has %d entries, %v", path, len(entries), err)
+			}
+		} else if content, err := os.ReadFile(path); err != nil || len(content) > 0 {
+			t.Errorf("masked file %s has %d bytes, %v", path, len(content), err)
+		}
+	}
+}
+
+func TestCreateRootlessDefaultSpec(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("creating containers in this test requires root")
+	}
+	if _, err := os.Stat("/proc/self/ns/user"); err != nil {
+		t.Skip("user namespaces are not supported")
+	}
+	useStateDir(t)
+
+	bundle := t.TempDir()
+	if err := os.Chmod(bundle, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	exe := testRootfs(t, filepath.Join(bundle, "rootfs"))
+
+	spec := DefaultSpec(true)
+	// The test binary checks the container process from inside.
+	spec.Process.Args = []string{exe, "-test.run=^TestContainerProcess$", "-test.v"}
+	spec.Process.Cwd = filepath.Dir(exe)
+	spec.Process.Env = append(spec.Process.Env, containerTestEnv+"=1")
+	// The container must not see the environment of the runtime.
+	t.Setenv("CONTAINERUNTIME_TEST_HOST", "1")
+	if err := WriteSpec(bundle, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	// The container inherits stdout and stderr, where the output of the test
+	// binary would be mistaken for that of this test.
+	output, err := os.Create(filepath.Join(t.TempDir(), "output"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = output, output
+	id := fmt.Sprintf("rootless-%d", os.Getpid())
+	err = Create(id, bundle, CreateOptions{CgroupBestEffort: true})
+	os.Stdout, os.Stderr = stdout, stderr
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	t.Cleanup(func() {
+		if err := Delete(id); err != nil {
+			t.Errorf("Delete() = %v", err)
+		}
+	})
+	state, err := State(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Start(id); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+
+	// Init is a child of the test, which Create started.
+	var status syscall.WaitStatus
+	if _, err := syscall.Wait4(state.Pid, &status, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	log, _ := os.ReadFile(output.Name())
+	if !status.Exited() || status.ExitStatus() != 0 || !strings.Contains(string(log), "--- PASS: TestContainerProcess") {
+		t.Fatalf("container exited with %v, want TestContainerProcess to pass; output:\n%s", status, log)
+	}
+}
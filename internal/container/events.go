@@ -0,0 +1,93 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+// eventAnnotationPrefix prefixes the state annotations that record how often
+// each limit event occurred, such as "containeruntime/events.memory.oom_kill".
+const eventAnnotationPrefix = "containeruntime/events."
+
+// Event is a limit event of a container, such as an OOM kill.
+type Event struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	Count uint64 `json:"count"`
+}
+
+// Events calls handle for the limit events of a container: first for those
+// that occurred since they were last recorded, then for new ones as they
+// occur, until ctx is done or the container's cgroup is removed. Every event
+// is recorded in the container state.
+func Events(ctx context.Context, containerID string, handle func(Event) error) error {
+	unlock, err := lockContainer(containerID, syscall.LOCK_SH)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(containerID)
+	unlock()
+	if err != nil {
+		return err
+	}
+	path, ok := state.Annotations[cgroupPathAnnotation]
+	if !ok {
+		return fmt.Errorf("container: container %s has no recorded cgroup", containerID)
+	}
+	// cgroup v1 has no memory.events file to watch.
+	mode, err := cgroup.DetectMode()
+	if err != nil {
+		return fmt.Errorf("container: failed to detect cgroup mode: %w", err)
+	}
+	if mode != cgroup.Unified {
+		return fmt.Errorf("container: events require cgroup v2, but the host is in %s mode", mode)
+	}
+
+	since := make(cgroup.EventCounts)
+	for key, value := range state.Annotations {
+		eventType, ok := strings.CutPrefix(key, eventAnnotationPrefix)
+		if !ok {
+			continue
+		}
+		count, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("container: invalid event count %q for %s: %w", value, eventType, err)
+		}
+		since[eventType] = count
+	}
+
+	return cgroup.WatchEvents(ctx, path, since, func(e cgroup.Event) error {
+		if err := recordEvent(containerID, e); err != nil {
+			return err
+		}
+		return handle(Event{Type: e.Type, ID: containerID, Count: e.Count})
+	})
+}
+
+// recordEvent stores the count of an event in the container state, under the
+// container lock so that concurrent updates are not overwritten.
+func recordEvent(containerID string, e cgroup.Event) error {
+	unlock, err := lockContainer(containerID, syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := loadState(containerID)
+	if err != nil {
+		return err
+	}
+	if state.Annotations == nil {
+		state.Annotations = make(map[string]string)
+	}
+	state.Annotations[eventAnnotationPrefix+e.Type] = strconv.FormatUint(e.Count, 10)
+	if err := saveState(state); err != nil {
+		return fmt.Errorf("container: failed to record %s event of container %s: %w", e.Type, containerID, err)
+	}
+	return nil
+}
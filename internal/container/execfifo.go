@@ -0,0 +1,103 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// oPath is O_PATH from fcntl.h, which the syscall package does not define on
+// every architecture.
+const oPath = 0x200000
+
+// File descriptors that Create passes to the init process after the spec pipe.
+const (
+	initExecFIFOFd = 4
+	initLogFd      = 5
+)
+
+// startPollInterval is how often Start checks that init is still alive while
+// waiting for it to open the exec FIFO.
+const startPollInterval = 100 * time.Millisecond
+
+// createExecFIFO creates the exec FIFO of a container and returns an O_PATH
+// descriptor of it for init. Opening the FIFO itself would block until start.
+func createExecFIFO(containerID string) (*os.File, error) {
+	dir, err := containerDir(containerID)
+	if err != nil {
+		return nil, err
+	}
+	fifoPath := filepath.Join(dir, execFIFOFilename)
+	if err := syscall.Mkfifo(fifoPath, 0o600); err != nil {
+		return nil, fmt.Errorf("container: failed to create exec FIFO: %w", err)
+	}
+	fd, err := syscall.Open(fifoPath, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("container: failed to open exec FIFO: %w", err)
+	}
+	return os.NewFile(uintptr(fd), fifoPath), nil
+}
+
+// waitForStart blocks init until Start reads from the exec FIFO. The FIFO is
+// reopened for writing through the O_PATH descriptor passed by Create, as its
+// path may not be reachable from the container's mount namespace.
+func waitForStart() {
+	execFIFO := os.NewFile(initExecFIFOFd, execFIFOFilename)
+	defer execFIFO.Close()
+
+	fifo, err := os.OpenFile(fmt.Sprintf("/proc/self/fd/%d", initExecFIFOFd), os.O_WRONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		log.Fatalf("container: failed to open exec FIFO: %v", err)
+	}
+	if _, err := fifo.Write([]byte{0}); err != nil {
+		log.Fatalf("container: failed to write to exec FIFO: %v", err)
+	}
+	if err := fifo.Close(); err != nil {
+		log.Printf("container: failed to close exec FIFO: %v", err)
+	}
+}
+
+// releaseInit lets the init process of a created container execute the
+// container process, by reading from the exec FIFO it is blocked on. The FIFO
+// is removed once init has been released.
+func releaseInit(containerID string, pid int) error {
+	dir, err := containerDir(containerID)
+	if err != nil {
+		return err
+	}
+	fifoPath := filepath.Join(dir, execFIFOFilename)
+
+	released := make(chan error, 1)
+	go func() {
+		// Opening the FIFO blocks until init opens it for writing.
+		content, err := os.ReadFile(fifoPath)
+		if err == nil && len(content) == 0 {
+			err = errors.New("init closed the exec FIFO without writing to it")
+		}
+		released <- err
+	}()
+
+	ticker := time.NewTicker(startPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-released:
+			if err != nil {
+				return fmt.Errorf("container: failed to release init of container %s: %w", containerID, err)
+			}
+			if err := os.Remove(fifoPath); err != nil {
+				return fmt.Errorf("container: failed to remove exec FIFO: %w", err)
+			}
+			return nil
+		case <-ticker.C:
+			if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+				return fmt.Errorf("container: init process %d of container %s exited before it was started; see %s",
+					pid, containerID, filepath.Join(dir, logFilename))
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package container
+
+import (
+	"runtime/debug"
+	"slices"
+	"sort"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-spec/specs-go/features"
+
+	cgroupv1 "github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v1"
+	"github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+// VersionAnnotation is the features annotation carrying the runtime version.
+const VersionAnnotation = "io.github.yoonhyunwoo.containeruntime.version"
+
+// Features reports what the runtime supports, derived from its implementation
+// tables. The systemd cgroup driver is reported only if systemd is reachable.
+func Features() *features.Features {
+	return newFeatures(cgroup.SystemdAvailable())
+}
+
+// newFeatures reports what the runtime supports, given whether the systemd
+// cgroup driver can reach systemd.
+func newFeatures(systemd bool) *features.Features {
+	// Every namespace in the table is created by Create or init. Joining an
+	// existing namespace is not supported, and Validate rejects namespace paths.
+	namespaces := make([]string, 0, len(namespaceCloneFlags))
+	for ns := range namespaceCloneFlags {
+		namespaces = append(namespaces, string(ns))
+	}
+	sort.Strings(namespaces)
+
+	return &features.Features{
+		OCIVersionMin: minOCIVersion,
+		OCIVersionMax: specs.Version,
+		// The runtime runs no hooks, and Validate rejects specs that have any.
+		Hooks:        []string{},
+		MountOptions: mountOptionNames(),
+		Linux: &features.Linux{
+			Namespaces:   namespaces,
+			Capabilities: slices.Clone(capabilityNames),
+			Cgroup: &features.Cgroup{
+				V1:      boolPtr(len(cgroupv1.Controllers()) > 0),
+				V2:      boolPtr(len(cgroup.Controllers()) > 0),
+				Systemd: boolPtr(systemd),
+				Rdma:    boolPtr(slices.Contains(cgroup.Controllers(), "rdma")),
+			},
+			Seccomp:  &features.Seccomp{Enabled: boolPtr(false)},
+			Apparmor: &features.Apparmor{Enabled: boolPtr(false)},
+			Selinux:  &features.Selinux{Enabled: boolPtr(false)},
+		},
+		Annotations: map[string]string{
+			VersionAnnotation: runtimeVersion(),
+		},
+	}
+}
+
+func runtimeVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	return info.Main.Version
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
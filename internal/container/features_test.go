@@ -0,0 +1,41 @@
+package container
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestFeatures(t *testing.T) {
+	// Reaching systemd depends on the host, so the test decides.
+	f := newFeatures(true)
+
+	if f.OCIVersionMin != minOCIVersion || f.OCIVersionMax != specs.Version {
+		t.Errorf("OCI versions = %s to %s, want %s to %s", f.OCIVersionMin, f.OCIVersionMax, minOCIVersion, specs.Version)
+	}
+	if f.Hooks == nil || len(f.Hooks) > 0 {
+		t.Errorf("hooks = %#v, want an empty list", f.Hooks)
+	}
+	if !slices.IsSorted(f.MountOptions) || !slices.Contains(f.MountOptions, "rbind") {
+		t.Errorf("mount options = %v, want the sorted option table", f.MountOptions)
+	}
+
+	linux := f.Linux
+	if len(linux.Namespaces) != len(namespaceCloneFlags) || !slices.IsSorted(linux.Namespaces) {
+		t.Errorf("namespaces = %v, want the sorted namespace table", linux.Namespaces)
+	}
+	if !reflect.DeepEqual(linux.Capabilities, capabilityNames) {
+		t.Errorf("capabilities = %v, want %v", linux.Capabilities, capabilityNames)
+	}
+	if linux.Capabilities[0] = "changed"; capabilityNames[0] != "CAP_CHOWN" {
+		t.Error("changing the reported capabilities changed the capability table")
+	}
+	if !*linux.Cgroup.V1 || !*linux.Cgroup.V2 || !*linux.Cgroup.Rdma || !*linux.Cgroup.Systemd {
+		t.Errorf("cgroup features = %+v", linux.Cgroup)
+	}
+	if f := newFeatures(false); *f.Linux.Cgroup.Systemd {
+		t.Error("systemd is reported without being reachable")
+	}
+}
@@ -0,0 +1,39 @@
+package container
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// maxIDLength bounds container IDs, which name the container's state
+// directory and its cgroup or systemd scope.
+const maxIDLength = 128
+
+// idPattern matches valid container IDs. As an ID has to start with a letter
+// or digit, it can never be "." or "..".
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// InvalidIDError reports a container ID that cannot be used, as it could
+// escape the state directory or the cgroup hierarchy.
+type InvalidIDError struct {
+	ID     string
+	Reason string
+}
+
+func (e *InvalidIDError) Error() string {
+	return fmt.Sprintf("container: invalid container ID %q: %s", e.ID, e.Reason)
+}
+
+// ValidateID checks that a container ID consists of letters, digits, '_', '.'
+// and '-', starts with a letter or digit, and is at most maxIDLength long.
+func ValidateID(containerID string) error {
+	switch {
+	case containerID == "":
+		return &InvalidIDError{ID: containerID, Reason: "must not be empty"}
+	case len(containerID) > maxIDLength:
+		return &InvalidIDError{ID: containerID, Reason: fmt.Sprintf("must be at most %d characters long", maxIDLength)}
+	case !idPattern.MatchString(containerID):
+		return &InvalidIDError{ID: containerID, Reason: "must start with a letter or digit and contain only letters, digits, '_', '.' and '-'"}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestValidateID(t *testing.T) {
+	for _, id := range []string{"abc", "a", "0", "my-container_1.2", "A.b-C_d", strings.Repeat("a", maxIDLength)} {
+		if err := ValidateID(id); err != nil {
+			t.Errorf("ValidateID(%q) = %v, want nil", id, err)
+		}
+	}
+
+	for _, id := range []string{"", ".", "..", "../../etc/foo", "a/b", "-abc", "_abc", ".hidden", "a b", "a\x00b", "ä", strings.Repeat("a", maxIDLength+1)} {
+		var invalidErr *InvalidIDError
+		if err := ValidateID(id); !errors.As(err, &invalidErr) || invalidErr.ID != id {
+			t.Errorf("ValidateID(%q) = %v, want an InvalidIDError", id, err)
+		}
+	}
+}
+
+func TestInvalidIDNeverReachesTheFilesystem(t *testing.T) {
+	useStateDir(t)
+	root := containeruntimeStateDir
+	containeruntimeStateDir = filepath.Join(root, "state")
+	if err := os.Mkdir(containeruntimeStateDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	var invalidErr *InvalidIDError
+	if _, err := createContainerDir("../escaped"); !errors.As(err, &invalidErr) {
+		t.Errorf("createContainerDir = %v, want an InvalidIDError", err)
+	}
+	if _, err := lockContainer("..", syscall.LOCK_EX); !errors.As(err, &invalidErr) {
+		t.Errorf("lockContainer = %v, want an InvalidIDError", err)
+	}
+	if err := deleteState(".."); !errors.As(err, &invalidErr) {
+		t.Errorf("deleteState = %v, want an InvalidIDError", err)
+	}
+	if err := Delete("../state"); !errors.As(err, &invalidErr) {
+		t.Errorf("Delete = %v, want an InvalidIDError", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "escaped")); !os.IsNotExist(err) {
+		t.Errorf("a directory was created outside the state directory")
+	}
+	if _, err := os.Stat(containeruntimeStateDir); err != nil {
+		t.Errorf("the state directory was removed: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+type mountFlag struct {
+	clear bool
+	flag  uintptr
+}
+
+// mountFlags maps the mount options understood by the runtime to mount(2) flags.
+// Options not listed here are passed to the filesystem as mount data.
+var mountFlags = map[string]mountFlag{
+	"async":         {true, syscall.MS_SYNCHRONOUS},
+	"atime":         {true, syscall.MS_NOATIME},
+	"bind":          {false, syscall.MS_BIND},
+	"defaults":      {false, 0},
+	"dev":           {true, syscall.MS_NODEV},
+	"diratime":      {true, syscall.MS_NODIRATIME},
+	"dirsync":       {false, syscall.MS_DIRSYNC},
+	"exec":          {true, syscall.MS_NOEXEC},
+	"mand":          {false, syscall.MS_MANDLOCK},
+	"noatime":       {false, syscall.MS_NOATIME},
+	"nodev":         {false, syscall.MS_NODEV},
+	"nodiratime":    {false, syscall.MS_NODIRATIME},
+	"noexec":        {false, syscall.MS_NOEXEC},
+	"nomand":        {true, syscall.MS_MANDLOCK},
+	"norelatime":    {true, syscall.MS_RELATIME},
+	"nostrictatime": {true, syscall.MS_STRICTATIME},
+	"nosuid":        {false, syscall.MS_NOSUID},
+	"private":       {false, syscall.MS_PRIVATE},
+	"rbind":         {false, syscall.MS_BIND | syscall.MS_REC},
+	"relatime":      {false, syscall.MS_RELATIME},
+	"rprivate":      {false, syscall.MS_PRIVATE | syscall.MS_REC},
+	"rshared":       {false, syscall.MS_SHARED | syscall.MS_REC},
+	"rslave":        {false, syscall.MS_SLAVE | syscall.MS_REC},
+	"runbindable":   {false, syscall.MS_UNBINDABLE | syscall.MS_REC},
+	"ro":            {false, syscall.MS_RDONLY},
+	"rw":            {true, syscall.MS_RDONLY},
+	"shared":        {false, syscall.MS_SHARED},
+	"slave":         {false, syscall.MS_SLAVE},
+	"strictatime":   {false, syscall.MS_STRICTATIME},
+	"suid":          {true, syscall.MS_NOSUID},
+	"sync":          {false, syscall.MS_SYNCHRONOUS},
+	"unbindable":    {false, syscall.MS_UNBINDABLE},
+}
+
+const propagationFlags = syscall.MS_PRIVATE | syscall.MS_SHARED | syscall.MS_SLAVE | syscall.MS_UNBINDABLE
+
+// parseMountOptions splits OCI mount options into mount(2) flags and filesystem data.
+func parseMountOptions(options []string) (flags uintptr, data string) {
+	var dataOptions []string
+	for _, option := range options {
+		f, ok := mountFlags[option]
+		if !ok {
+			dataOptions = append(dataOptions, option)
+			continue
+		}
+		if f.clear {
+			flags &^= f.flag
+		} else {
+			flags |= f.flag
+		}
+	}
+	return flags, strings.Join(dataOptions, ",")
+}
+
+// mountOptionNames returns the mount options the runtime recognizes, sorted.
+func mountOptionNames() []string {
+	names := make([]string, 0, len(mountFlags))
+	for name := range mountFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mountCall is the arguments of one mount(2) call.
+type mountCall struct {
+	source string
+	target string
+	fstype string
+	flags  uintptr
+	data   string
+}
+
+// mountSteps returns the mount(2) calls that set up an OCI mount.
+func mountSteps(m specs.Mount) []mountCall {
+	flags, data := parseMountOptions(m.Options)
+
+	// Propagation changes must be applied by a separate mount(2) call.
+	propagation := flags & propagationFlags
+	flags &^= propagationFlags
+
+	steps := []mountCall{{m.Source, m.Destination, m.Type, flags, data}}
+
+	// A bind mount ignores most flags, so they are applied by remounting it.
+	if flags&syscall.MS_BIND != 0 && flags&^(syscall.MS_BIND|syscall.MS_REC) != 0 {
+		steps = append(steps, mountCall{target: m.Destination, flags: flags | syscall.MS_REMOUNT})
+	}
+
+	if propagation != 0 {
+		steps = append(steps, mountCall{target: m.Destination, flags: propagation | flags&syscall.MS_REC})
+	}
+	return steps
+}
+
+// mountEntry sets up an OCI mount at its destination below rootfs, creating
+// the destination directory first.
+func mountEntry(rootfs string, m specs.Mount) error {
+	destination := m.Destination
+	m.Destination = filepath.Join(rootfs, destination)
+	if err := os.MkdirAll(m.Destination, 0o750); err != nil {
+		return fmt.Errorf("container: failed to create mount destination %s: %w", destination, err)
+	}
+
+	for i, step := range mountSteps(m) {
+		if err := syscall.Mount(step.source, step.target, step.fstype, step.flags, step.data); err != nil {
+			switch {
+			case i == 0:
+				return fmt.Errorf("container: failed to mount %s: %w", destination, err)
+			case step.flags&syscall.MS_REMOUNT != 0:
+				return fmt.Errorf("container: failed to remount %s: %w", destination, err)
+			default:
+				return fmt.Errorf("container: failed to set propagation for %s: %w", destination, err)
+			}
+		}
+	}
+	return nil
+}
+
+// maskPath hides path below rootfs from the container: a directory is covered
+// by an empty read-only tmpfs, and any other file by /dev/null. Paths that do
+// not exist are skipped.
+func maskPath(rootfs, path string) error {
+	target := filepath.Join(rootfs, path)
+	info, err := os.Stat(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("container: failed to stat masked path %s: %w", path, err)
+	}
+	if info.IsDir() {
+		err = syscall.Mount("tmpfs", target, "tmpfs", syscall.MS_RDONLY, "")
+	} else {
+		err = syscall.Mount("/dev/null", target, "", syscall.MS_BIND, "")
+	}
+	if err != nil {
+		return fmt.Errorf("container: failed to mask %s: %w", path, err)
+	}
+	return nil
+}
+
+// readonlyPath makes path below rootfs read-only by bind mounting it onto
+// itself. Paths that do not exist are skipped.
+func readonlyPath(rootfs, path string) error {
+	target := filepath.Join(rootfs, path)
+	if err := syscall.Mount(target, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("container: failed to bind mount readonly path %s: %w", path, err)
+	}
+	return remountReadonly(target)
+}
+
+// remountReadonly makes the bind mount at path read-only, keeping the flags
+// that are locked on it, such as nosuid in a user namespace.
+func remountReadonly(path string) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return fmt.Errorf("container: failed to stat %s: %w", path, err)
+	}
+	// The ST_* flags reported by statfs(2) match the MS_* mount flags.
+	locked := uintptr(st.Flags) & (syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC | syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME)
+	if err := syscall.Mount("", path, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|locked, ""); err != nil {
+		return fmt.Errorf("container: failed to remount %s read-only: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package container
+
+import (
+	"reflect"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestParseMountOptions(t *testing.T) {
+	tests := []struct {
+		options   []string
+		wantFlags uintptr
+		wantData  string
+	}{
+		{nil, 0, ""},
+		{[]string{"defaults"}, 0, ""},
+		{[]string{"nosuid", "noexec", "nodev", "ro"}, syscall.MS_NOSUID | syscall.MS_NOEXEC | syscall.MS_NODEV | syscall.MS_RDONLY, ""},
+		{[]string{"rbind", "rprivate"}, syscall.MS_BIND | syscall.MS_REC | syscall.MS_PRIVATE, ""},
+		// Later options override earlier ones.
+		{[]string{"ro", "rw"}, 0, ""},
+		{[]string{"nosuid", "suid", "noatime", "atime"}, 0, ""},
+		{[]string{"nosuid", "mode=755", "size=65536k"}, syscall.MS_NOSUID, "mode=755,size=65536k"},
+		{[]string{"newinstance", "strictatime", "ptmxmode=0666"}, syscall.MS_STRICTATIME, "newinstance,ptmxmode=0666"},
+	}
+	for _, tt := range tests {
+		flags, data := parseMountOptions(tt.options)
+		if flags != tt.wantFlags || data != tt.wantData {
+			t.Errorf("parseMountOptions(%q) = %#x, %q, want %#x, %q", tt.options, flags, data, tt.wantFlags, tt.wantData)
+		}
+	}
+}
+
+func TestMountOptionNames(t *testing.T) {
+	names := mountOptionNames()
+	if len(names) != len(mountFlags) || !slices.IsSorted(names) {
+		t.Errorf("mountOptionNames() = %v, want every option of mountFlags, sorted", names)
+	}
+}
+
+func TestMountSteps(t *testing.T) {
+	tests := []struct {
+		name  string
+		mount specs.Mount
+		want  []mountCall
+	}{
+		{
+			name:  "filesystem with data",
+			mount: specs.Mount{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "mode=755"}},
+			want:  []mountCall{{"tmpfs", "/dev", "tmpfs", syscall.MS_NOSUID, "mode=755"}},
+		},
+		{
+			name:  "plain bind mount",
+			mount: specs.Mount{Destination: "/data", Type: "bind", Source: "/srv", Options: []string{"rbind"}},
+			want:  []mountCall{{"/srv", "/data", "bind", syscall.MS_BIND | syscall.MS_REC, ""}},
+		},
+		{
+			name:  "read-only bind mount is remounted",
+			mount: specs.Mount{Destination: "/sys", Type: "none", Source: "/sys", Options: []string{"rbind", "nosuid", "ro"}},
+			want: []mountCall{
+				{"/sys", "/sys", "none", syscall.MS_BIND | syscall.MS_REC | syscall.MS_NOSUID | syscall.MS_RDONLY, ""},
+				{"", "/sys", "", syscall.MS_BIND | syscall.MS_REC | syscall.MS_NOSUID | syscall.MS_RDONLY | syscall.MS_REMOUNT, ""},
+			},
+		},
+		{
+			name:  "propagation is set separately",
+			mount: specs.Mount{Destination: "/shared", Type: "bind", Source: "/srv", Options: []string{"rbind", "rslave"}},
+			want: []mountCall{
+				{"/srv", "/shared", "bind", syscall.MS_BIND | syscall.MS_REC, ""},
+				{"", "/shared", "", syscall.MS_SLAVE | syscall.MS_REC, ""},
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := mountSteps(tt.mount); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: mountSteps() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
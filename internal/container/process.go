@@ -0,0 +1,119 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// rlimitResources maps the rlimit types the runtime supports to setrlimit(2)
+// resources.
+var rlimitResources = map[string]int{
+	"RLIMIT_CPU":        0,
+	"RLIMIT_FSIZE":      1,
+	"RLIMIT_DATA":       2,
+	"RLIMIT_STACK":      3,
+	"RLIMIT_CORE":       4,
+	"RLIMIT_RSS":        5,
+	"RLIMIT_NPROC":      6,
+	"RLIMIT_NOFILE":     7,
+	"RLIMIT_MEMLOCK":    8,
+	"RLIMIT_AS":         9,
+	"RLIMIT_LOCKS":      10,
+	"RLIMIT_SIGPENDING": 11,
+	"RLIMIT_MSGQUEUE":   12,
+	"RLIMIT_NICE":       13,
+	"RLIMIT_RTPRIO":     14,
+	"RLIMIT_RTTIME":     15,
+}
+
+// setRlimits applies the resource limits of a process. Raising a hard limit
+// needs CAP_SYS_RESOURCE, so this runs before the user and capabilities change.
+func setRlimits(rlimits []specs.POSIXRlimit) error {
+	for _, rlimit := range rlimits {
+		resource, ok := rlimitResources[rlimit.Type]
+		if !ok {
+			return fmt.Errorf("container: unsupported rlimit %q", rlimit.Type)
+		}
+		if err := syscall.Setrlimit(resource, &syscall.Rlimit{Cur: rlimit.Soft, Max: rlimit.Hard}); err != nil {
+			return fmt.Errorf("container: failed to set %s: %w", rlimit.Type, err)
+		}
+	}
+	return nil
+}
+
+// setUser switches the calling process to the user of a spec. The permitted
+// capabilities are kept across the switch, so that applyCapabilities can
+// still grant them afterwards.
+func setUser(user specs.User) error {
+	setgroups, err := os.ReadFile("/proc/self/setgroups")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("container: failed to read setgroups policy: %w", err)
+	}
+	// A user namespace set up by an unprivileged user denies setgroups(2).
+	if strings.TrimSpace(string(setgroups)) == "deny" {
+		if len(user.AdditionalGids) > 0 {
+			return errors.New("container: additional groups cannot be set in a user namespace that denies setgroups")
+		}
+	} else {
+		gids := make([]int, 0, len(user.AdditionalGids))
+		for _, gid := range user.AdditionalGids {
+			gids = append(gids, int(gid))
+		}
+		if err := syscall.Setgroups(gids); err != nil {
+			return fmt.Errorf("container: failed to set additional groups: %w", err)
+		}
+	}
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetKeepCaps, 1, 0); errno != 0 {
+		return fmt.Errorf("container: failed to keep capabilities: %w", errno)
+	}
+	if err := syscall.Setgid(int(user.GID)); err != nil {
+		return fmt.Errorf("container: failed to set group %d: %w", user.GID, err)
+	}
+	if err := syscall.Setuid(int(user.UID)); err != nil {
+		return fmt.Errorf("container: failed to set user %d: %w", user.UID, err)
+	}
+	return nil
+}
+
+// setNoNewPrivileges stops the container process from gaining privileges
+// through execve, such as from setuid binaries.
+func setNoNewPrivileges() error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("container: failed to set no_new_privs: %w", errno)
+	}
+	return nil
+}
+
+// lookPath resolves the executable of a container process the way execvp(3)
+// would, searching the PATH of the process environment env instead of the
+// runtime's own.
+func lookPath(file string, env []string) (string, error) {
+	if strings.Contains(file, "/") {
+		return file, nil
+	}
+	// Like getenv(3), the first PATH entry wins.
+	var path string
+	for _, e := range env {
+		if value, ok := strings.CutPrefix(e, "PATH="); ok {
+			path = value
+			break
+		}
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		if found, err := exec.LookPath(filepath.Join(dir, file)); err == nil {
+			return found, nil
+		}
+	}
+	return "", fmt.Errorf("container: executable %q not found in the PATH of the process", file)
+}
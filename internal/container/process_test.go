@@ -0,0 +1,46 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookPath(t *testing.T) {
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{"tool": 0o755, "data": 0o644} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env := []string{"PATH=/nonexistent:" + dir, "TERM=xterm"}
+
+	tests := []struct {
+		file    string
+		env     []string
+		want    string
+		wantErr bool
+	}{
+		{file: "tool", env: env, want: filepath.Join(dir, "tool")},
+		{file: "/bin/anything", env: env, want: "/bin/anything"},
+		{file: "./tool", env: nil, want: "./tool"},
+		// Only executables are found.
+		{file: "data", env: env, wantErr: true},
+		// The runtime's own PATH is never searched.
+		{file: "tool", env: []string{"TERM=xterm"}, wantErr: true},
+		// The first PATH entry wins.
+		{file: "tool", env: []string{"PATH=/nonexistent", "PATH=" + dir}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := lookPath(tt.file, tt.env)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("lookPath(%q, %q) = %q, want error", tt.file, tt.env, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("lookPath(%q, %q) = %q, %v, want %q", tt.file, tt.env, got, err, tt.want)
+		}
+	}
+}
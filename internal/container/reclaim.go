@@ -0,0 +1,91 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+// ReclaimResult reports a proactive memory reclaim of a container.
+type ReclaimResult struct {
+	ID        string `json:"id"`
+	Requested uint64 `json:"requested"`
+	Reclaimed uint64 `json:"reclaimed"`
+}
+
+// Reclaim asks the kernel to reclaim amount bytes of memory, such as page
+// cache, from a container. A nil swappiness keeps the cgroup's own balance
+// between anonymous and file memory.
+func Reclaim(containerID string, amount uint64, swappiness *int) (ReclaimResult, error) {
+	path, err := reclaimPath(containerID)
+	if err != nil {
+		return ReclaimResult{}, err
+	}
+	return reclaim(containerID, path, amount, swappiness)
+}
+
+// ReclaimToWorkingSet reclaims memory from a container every interval, so that
+// its working set makes up percent of its memory usage, until ctx is done.
+// report is called after every reclaim that had something to reclaim.
+func ReclaimToWorkingSet(ctx context.Context, containerID string, percent uint64, interval time.Duration, swappiness *int, report func(ReclaimResult) error) error {
+	if interval <= 0 {
+		return fmt.Errorf("container: reclaim interval must be positive, got %s", interval)
+	}
+	path, err := reclaimPath(containerID)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		amount, err := cgroup.ReclaimTarget(path, percent)
+		if err != nil {
+			return fmt.Errorf("container: failed to compute reclaim target of container %s: %w", containerID, err)
+		}
+		if amount > 0 {
+			result, err := reclaim(containerID, path, amount, swappiness)
+			if err != nil {
+				return err
+			}
+			if err := report(result); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func reclaim(containerID, path string, amount uint64, swappiness *int) (ReclaimResult, error) {
+	reclaimed, err := cgroup.ReclaimMemory(path, amount, swappiness)
+	if err != nil {
+		return ReclaimResult{}, fmt.Errorf("container: failed to reclaim memory of container %s: %w", containerID, err)
+	}
+	return ReclaimResult{ID: containerID, Requested: amount, Reclaimed: reclaimed}, nil
+}
+
+// reclaimPath returns the cgroup of a container.
+func reclaimPath(containerID string) (string, error) {
+	unlock, err := lockContainer(containerID, syscall.LOCK_SH)
+	if err != nil {
+		return "", err
+	}
+	state, err := loadState(containerID)
+	unlock()
+	if err != nil {
+		return "", err
+	}
+	path, ok := state.Annotations[cgroupPathAnnotation]
+	if !ok {
+		return "", fmt.Errorf("container: container %s has no recorded cgroup", containerID)
+	}
+	return path, nil
+}
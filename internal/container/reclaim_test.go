@@ -0,0 +1,19 @@
+package container
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReclaimToWorkingSetRejectsInterval(t *testing.T) {
+	useStateDir(t)
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		err := ReclaimToWorkingSet(context.Background(), "ctr", 50, interval, nil, func(ReclaimResult) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "interval") {
+			t.Errorf("ReclaimToWorkingSet with interval %s = %v, want an interval error", interval, err)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
 
@@ -26,71 +28,336 @@ func loadSpec(specPath string) (*specs.Spec, error) {
 	return &spec, nil
 }
 
-func createCgroupSubSystems(spec *specs.Spec) []cgroup.SubSystem {
+func hasNamespace(spec *specs.Spec, nsType specs.LinuxNamespaceType) bool {
+	if spec.Linux == nil {
+		return false
+	}
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Type == nsType {
+			return true
+		}
+	}
+	return false
+}
+
+// miscMaxKey is the linux.resources.unified key that configures the misc
+// subsystem instead of being written as it is.
+const miscMaxKey = "misc.max"
+
+// unifiedValues returns the linux.resources.unified values that are written
+// as they are, leaving out the keys handled by a cgroup v2 subsystem.
+func unifiedValues(unified map[string]string) map[string]string {
+	if _, ok := unified[miscMaxKey]; !ok {
+		return unified
+	}
+	values := make(map[string]string, len(unified))
+	for key, value := range unified {
+		if key != miscMaxKey {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// createCgroupSubSystems translates OCI resources into cgroup v2 subsystems.
+// Fields left unset in the spec are left unset in the subsystems, so the
+// kernel defaults stay in place.
+func createCgroupSubSystems(spec *specs.Spec) ([]cgroup.SubSystem, error) {
 	var subSystems []cgroup.SubSystem
 	if spec.Linux == nil || spec.Linux.Resources == nil {
-		return nil
+		return nil, nil
 	}
 	if spec.Linux.Resources.Memory != nil {
-		mem := spec.Linux.Resources.Memory
-		oomGroup := int64(0)
-		if *mem.DisableOOMKiller {
-			oomGroup = int64(1)
-		}
-		memorySubSys := &cgroup.MemorySubSystem{
-			Max:      *mem.Limit,
-			High:     *mem.Reservation,
-			SwapHigh: *mem.Swap,
-			OOMGroup: oomGroup,
+		memorySubSys, err := memorySubSystem(spec.Linux.Resources.Memory)
+		if err != nil {
+			return nil, err
 		}
 		subSystems = append(subSystems, memorySubSys)
 	}
 
 	if spec.Linux.Resources.CPU != nil {
 		cpu := spec.Linux.Resources.CPU
-		cpuSubSys := &cgroup.CPUSubSystem{
-			Quota:    *cpu.Quota,
-			Period:   *cpu.Period,
-			Idle:     *cpu.Idle,
-			Weight:   *cpu.Shares,
-			MaxBurst: *cpu.Burst,
+		subSystems = append(subSystems, cpuSubSystem(cpu))
+		if cpu.Cpus != "" || cpu.Mems != "" {
+			subSystems = append(subSystems, &cgroup.CpusetSubSystem{Cpus: cpu.Cpus, Mems: cpu.Mems})
+		}
+	}
+
+	// A zero pids limit is treated as unset, and any negative value as unlimited.
+	if spec.Linux.Resources.Pids != nil && spec.Linux.Resources.Pids.Limit != 0 {
+		subSystems = append(subSystems, cgroup.NewPidsSubSystem(spec.Linux.Resources.Pids.Limit))
+	}
+
+	if spec.Linux.Resources.BlockIO != nil {
+		subSystems = append(subSystems, ioSubSystem(spec.Linux.Resources.BlockIO))
+	}
+
+	if len(spec.Linux.Resources.Rdma) > 0 {
+		rdmaSubSys := &cgroup.RDMASubsystem{Limits: make(map[string]cgroup.RDMALimit)}
+		for device, rdma := range spec.Linux.Resources.Rdma {
+			rdmaSubSys.Limits[device] = cgroup.RDMALimit{
+				HCAHandles: rdma.HcaHandles,
+				HCAObjects: rdma.HcaObjects,
+			}
+		}
+		subSystems = append(subSystems, rdmaSubSys)
+	}
+
+	if len(spec.Linux.Resources.HugepageLimits) > 0 {
+		hugepageSubSys := &cgroup.HugepageSubSystem{Limits: make(map[string]cgroup.HugepageLimit)}
+		for _, hugepage := range spec.Linux.Resources.HugepageLimits {
+			pageSize, err := cgroup.ValidatePageSize(hugepage.Pagesize)
+			if err != nil {
+				return nil, fmt.Errorf("container: invalid hugepage limit: %w", err)
+			}
+			// The spec has a single limit per page size; it bounds reservations
+			// too, so pages reserved by mmap cannot bypass it.
+			limit := hugepage.Limit
+			hugepageSubSys.Limits[pageSize] = cgroup.HugepageLimit{Max: &limit, RsvdMax: &limit}
+		}
+		subSystems = append(subSystems, hugepageSubSys)
+	}
+
+	if value, ok := spec.Linux.Resources.Unified[miscMaxKey]; ok {
+		limits, err := cgroup.ParseMiscMax(value)
+		if err != nil {
+			return nil, fmt.Errorf("container: invalid unified key %s: %w", miscMaxKey, err)
+		}
+		subSystems = append(subSystems, &cgroup.MiscSubSystem{Max: limits})
+	}
+
+	return subSystems, nil
+}
+
+func memorySubSystem(mem *specs.LinuxMemory) (*cgroup.MemorySubSystem, error) {
+	// DisableOOMKiller and Swappiness have no cgroup v2 equivalent and are ignored.
+	memorySubSys := &cgroup.MemorySubSystem{
+		Max: nonZero(mem.Limit),
+		Low: nonZero(mem.Reservation),
+	}
+
+	var limit, swap int64
+	if mem.Limit != nil {
+		limit = *mem.Limit
+	}
+	if mem.Swap != nil {
+		swap = *mem.Swap
+	}
+	swapMax, err := cgroup.ConvertMemorySwapToV2(limit, swap)
+	if err != nil {
+		return nil, fmt.Errorf("container: invalid memory resources: %w", err)
+	}
+	if swapMax != 0 {
+		memorySubSys.SwapMax = &swapMax
+	}
+	return memorySubSys, nil
+}
+
+func ioSubSystem(blockIO *specs.LinuxBlockIO) *cgroup.IOSubSystem {
+	// LeafWeight has no cgroup v2 equivalent and is ignored.
+	ioSubSys := &cgroup.IOSubSystem{}
+
+	if blockIO.Weight != nil && *blockIO.Weight != 0 {
+		weight := cgroup.ConvertBlkIOToIOWeight(*blockIO.Weight)
+		ioSubSys.Weight = &weight
+	}
+
+	for _, dev := range blockIO.WeightDevice {
+		if dev.Weight == nil || *dev.Weight == 0 {
+			continue
+		}
+		if ioSubSys.DeviceWeights == nil {
+			ioSubSys.DeviceWeights = make(map[cgroup.IODevice]uint64)
 		}
-		subSystems = append(subSystems, cpuSubSys)
+		ioSubSys.DeviceWeights[cgroup.IODevice{Major: dev.Major, Minor: dev.Minor}] = cgroup.ConvertBlkIOToIOWeight(*dev.Weight)
 	}
 
-	if spec.Linux.Resources.Pids != nil {
-		pidsSubSys := &cgroup.PidsSubSystem{
-			MaxPids: spec.Linux.Resources.Pids.Limit,
+	throttles := []struct {
+		devices []specs.LinuxThrottleDevice
+		set     func(l *cgroup.IOLimit, rate *uint64)
+	}{
+		{blockIO.ThrottleReadBpsDevice, func(l *cgroup.IOLimit, rate *uint64) { l.RBps = rate }},
+		{blockIO.ThrottleWriteBpsDevice, func(l *cgroup.IOLimit, rate *uint64) { l.WBps = rate }},
+		{blockIO.ThrottleReadIOPSDevice, func(l *cgroup.IOLimit, rate *uint64) { l.RIOps = rate }},
+		{blockIO.ThrottleWriteIOPSDevice, func(l *cgroup.IOLimit, rate *uint64) { l.WIOps = rate }},
+	}
+	for _, throttle := range throttles {
+		for _, dev := range throttle.devices {
+			if ioSubSys.DeviceLimits == nil {
+				ioSubSys.DeviceLimits = make(map[cgroup.IODevice]cgroup.IOLimit)
+			}
+			device := cgroup.IODevice{Major: dev.Major, Minor: dev.Minor}
+			limit := ioSubSys.DeviceLimits[device]
+			rate := dev.Rate
+			throttle.set(&limit, &rate)
+			ioSubSys.DeviceLimits[device] = limit
 		}
-		subSystems = append(subSystems, pidsSubSys)
 	}
+	return ioSubSys
+}
+
+// nonZero returns nil for unset or zero values, which OCI treats alike.
+func nonZero(value *int64) *int64 {
+	if value == nil || *value == 0 {
+		return nil
+	}
+	return value
+}
 
-	if spec.Linux.Resources.Rdma != nil {
-		rdma := spec.Linux.Resources.Rdma
+func cpuSubSystem(cpu *specs.LinuxCPU) *cgroup.CPUSubSystem {
+	cpuSubSys := &cgroup.CPUSubSystem{
+		Idle:     cpu.Idle,
+		MaxBurst: cpu.Burst,
+	}
 
-		rdmaSubSys := &cgroup.RDMASubsystem{
-			Max: cgroup.RDMAHCA{
-				HCAHandle: int64(*rdma["max"].HcaHandles),
-				HCAObject: int64(*rdma["max"].HcaObjects),
+	if cpu.Shares != nil && *cpu.Shares != 0 {
+		weight := cgroup.ConvertCPUSharesToWeight(*cpu.Shares)
+		cpuSubSys.Weight = &weight
+	}
+
+	// A zero quota or period means unset; a non-positive quota means unlimited.
+	if cpu.Quota != nil && *cpu.Quota != 0 {
+		quota := *cpu.Quota
+		if quota < 0 {
+			quota = -1
+		}
+		cpuSubSys.Quota = &quota
+	}
+	if cpu.Period != nil && *cpu.Period != 0 {
+		cpuSubSys.Period = cpu.Period
+	}
+	return cpuSubSys
+}
+
+// DefaultSpec returns a default container configuration. The rootless variant
+// runs in a user namespace mapping the calling user to root in the container.
+func DefaultSpec(rootless bool) *specs.Spec {
+	defaultCaps := []string{"CAP_AUDIT_WRITE", "CAP_KILL", "CAP_NET_BIND_SERVICE"}
+
+	spec := &specs.Spec{
+		Version: specs.Version,
+		Root: &specs.Root{
+			Path:     "rootfs",
+			Readonly: true,
+		},
+		Process: &specs.Process{
+			Terminal: false,
+			User:     specs.User{UID: 0, GID: 0},
+			Args:     []string{"sh"},
+			Env: []string{
+				"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+				"TERM=xterm",
+			},
+			Cwd: "/",
+			Capabilities: &specs.LinuxCapabilities{
+				Bounding:  defaultCaps,
+				Effective: defaultCaps,
+				Permitted: defaultCaps,
+			},
+			Rlimits: []specs.POSIXRlimit{
+				{Type: "RLIMIT_NOFILE", Hard: 1024, Soft: 1024},
+			},
+			NoNewPrivileges: true,
+		},
+		Hostname: "containeruntime",
+		Mounts: []specs.Mount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "strictatime", "mode=755", "size=65536k"}},
+			{Destination: "/dev/pts", Type: "devpts", Source: "devpts", Options: []string{"nosuid", "noexec", "newinstance", "ptmxmode=0666", "mode=0620", "gid=5"}},
+			{Destination: "/dev/shm", Type: "tmpfs", Source: "shm", Options: []string{"nosuid", "noexec", "nodev", "mode=1777", "size=65536k"}},
+			{Destination: "/dev/mqueue", Type: "mqueue", Source: "mqueue", Options: []string{"nosuid", "noexec", "nodev"}},
+			{Destination: "/sys", Type: "sysfs", Source: "sysfs", Options: []string{"nosuid", "noexec", "nodev", "ro"}},
+			{Destination: "/sys/fs/cgroup", Type: "cgroup2", Source: "cgroup", Options: []string{"nosuid", "noexec", "nodev", "relatime", "ro"}},
+		},
+		Linux: &specs.Linux{
+			Resources: &specs.LinuxResources{
+				Devices: []specs.LinuxDeviceCgroup{{Allow: false, Access: "rwm"}},
+			},
+			Namespaces: []specs.LinuxNamespace{
+				{Type: specs.PIDNamespace},
+				{Type: specs.NetworkNamespace},
+				{Type: specs.IPCNamespace},
+				{Type: specs.UTSNamespace},
+				{Type: specs.MountNamespace},
+				{Type: specs.CgroupNamespace},
 			},
-			Current: cgroup.RDMAHCA{
-				HCAHandle: int64(*rdma["current"].HcaHandles),
-				HCAObject: int64(*rdma["current"].HcaObjects),
+			MaskedPaths: []string{
+				"/proc/acpi", "/proc/asound", "/proc/kcore", "/proc/keys", "/proc/latency_stats",
+				"/proc/timer_list", "/proc/timer_stats", "/proc/sched_debug", "/proc/scsi",
+				"/sys/firmware", "/sys/devices/virtual/powercap",
 			},
+			ReadonlyPaths: []string{
+				"/proc/bus", "/proc/fs", "/proc/irq", "/proc/sys", "/proc/sysrq-trigger",
+			},
+		},
+	}
+
+	if rootless {
+		toRootless(spec, os.Getuid(), os.Getgid())
+	}
+	return spec
+}
+
+// toRootless adjusts a spec so it can be run by an unprivileged user.
+func toRootless(spec *specs.Spec, uid, gid int) {
+	var namespaces []specs.LinuxNamespace
+	for _, ns := range spec.Linux.Namespaces {
+		// A network namespace would leave the container without connectivity,
+		// since an unprivileged user cannot configure host-side interfaces.
+		if ns.Type != specs.NetworkNamespace && ns.Type != specs.UserNamespace {
+			namespaces = append(namespaces, ns)
 		}
-		subSystems = append(subSystems, rdmaSubSys)
 	}
+	spec.Linux.Namespaces = append(namespaces, specs.LinuxNamespace{Type: specs.UserNamespace})
 
-	if spec.Linux.Resources.HugepageLimits != nil {
-		for _, hugepage := range spec.Linux.Resources.HugepageLimits {
-			hugepageSubSys := &cgroup.HugepageSubSystem{
-				Pages: map[string]uint64{
-					hugepage.Pagesize: hugepage.Limit,
-				},
+	spec.Linux.UIDMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: uint32(uid), Size: 1}}
+	spec.Linux.GIDMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: uint32(gid), Size: 1}}
+
+	var mounts []specs.Mount
+	for _, m := range spec.Mounts {
+		switch m.Destination {
+		case "/sys":
+			// sysfs cannot be mounted without owning the network namespace.
+			m = specs.Mount{Destination: "/sys", Type: "none", Source: "/sys", Options: []string{"rbind", "nosuid", "noexec", "nodev", "ro"}}
+		case "/sys/fs/cgroup":
+			// The cgroup tree is already visible through the /sys bind mount.
+			continue
+		}
+
+		// Only the calling user and group are mapped, so other IDs are invalid.
+		var options []string
+		for _, o := range m.Options {
+			if !strings.HasPrefix(o, "gid=") && !strings.HasPrefix(o, "uid=") {
+				options = append(options, o)
 			}
-			subSystems = append(subSystems, hugepageSubSys)
 		}
+		m.Options = options
+		mounts = append(mounts, m)
 	}
+	spec.Mounts = mounts
 
-	return subSystems
+	// Resource limits need a delegated cgroup, which is not guaranteed for rootless users.
+	spec.Linux.Resources = nil
+}
+
+// WriteSpec writes spec as config.json in the bundle directory. An existing
+// config.json is never overwritten.
+func WriteSpec(bundlePath string, spec *specs.Spec) error {
+	configPath := filepath.Join(bundlePath, "config.json")
+
+	specBytes, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("container: failed to marshal spec to JSON: %w", err)
+	}
+
+	f, err := os.OpenFile(configPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("container: failed to create spec file at %s: %w", configPath, err)
+	}
+	defer f.Close()
+
+	if _, err = f.Write(specBytes); err != nil {
+		return fmt.Errorf("container: failed to write spec file at %s: %w", configPath, err)
+	}
+	return f.Close()
 }
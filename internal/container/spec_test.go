@@ -0,0 +1,321 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+func int64Ptr(v int64) *int64    { return &v }
+func uint64Ptr(v uint64) *uint64 { return &v }
+
+func uint16Ptr(v uint16) *uint16 { return &v }
+func uint32Ptr(v uint32) *uint32 { return &v }
+
+func throttleDevice(major, minor int64, rate uint64) specs.LinuxThrottleDevice {
+	dev := specs.LinuxThrottleDevice{Rate: rate}
+	dev.Major = major
+	dev.Minor = minor
+	return dev
+}
+
+func TestCreateCgroupSubSystems(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources *specs.LinuxResources
+		want      map[string]string
+		wantErr   bool
+	}{
+		{
+			name:      "no resources",
+			resources: nil,
+			want:      map[string]string{},
+		},
+		{
+			name: "partial memory leaves other files alone",
+			resources: &specs.LinuxResources{
+				Memory: &specs.LinuxMemory{Limit: int64Ptr(256 << 20)},
+			},
+			want: map[string]string{"memory.max": "268435456"},
+		},
+		{
+			name: "reservation maps to memory.low and swap excludes memory",
+			resources: &specs.LinuxResources{
+				Memory: &specs.LinuxMemory{
+					Limit:            int64Ptr(512 << 20),
+					Reservation:      int64Ptr(128 << 20),
+					Swap:             int64Ptr(768 << 20),
+					DisableOOMKiller: boolPtr(true),
+				},
+			},
+			want: map[string]string{
+				"memory.max":      "536870912",
+				"memory.low":      "134217728",
+				"memory.swap.max": "268435456",
+			},
+		},
+		{
+			name: "unlimited memory implies unlimited swap",
+			resources: &specs.LinuxResources{
+				Memory: &specs.LinuxMemory{Limit: int64Ptr(-1)},
+			},
+			want: map[string]string{"memory.max": "max", "memory.swap.max": "max"},
+		},
+		{
+			name: "swap without memory limit",
+			resources: &specs.LinuxResources{
+				Memory: &specs.LinuxMemory{Swap: int64Ptr(1 << 30)},
+			},
+			wantErr: true,
+		},
+		{
+			name: "swap below memory limit",
+			resources: &specs.LinuxResources{
+				Memory: &specs.LinuxMemory{Limit: int64Ptr(1 << 30), Swap: int64Ptr(1 << 20)},
+			},
+			wantErr: true,
+		},
+		{
+			name: "shares convert to weight",
+			resources: &specs.LinuxResources{
+				CPU: &specs.LinuxCPU{Shares: uint64Ptr(1024)},
+			},
+			want: map[string]string{"cpu.weight": "39"},
+		},
+		{
+			name: "shares range bounds",
+			resources: &specs.LinuxResources{
+				CPU: &specs.LinuxCPU{Shares: uint64Ptr(262144)},
+			},
+			want: map[string]string{"cpu.weight": "10000"},
+		},
+		{
+			name: "quota and period",
+			resources: &specs.LinuxResources{
+				CPU: &specs.LinuxCPU{Quota: int64Ptr(50000), Period: uint64Ptr(100000)},
+			},
+			want: map[string]string{"cpu.max": "50000 100000"},
+		},
+		{
+			name: "period only keeps quota unlimited",
+			resources: &specs.LinuxResources{
+				CPU: &specs.LinuxCPU{Period: uint64Ptr(200000)},
+			},
+			want: map[string]string{"cpu.max": "max 200000"},
+		},
+		{
+			name: "negative quota is unlimited",
+			resources: &specs.LinuxResources{
+				CPU: &specs.LinuxCPU{Quota: int64Ptr(-1)},
+			},
+			want: map[string]string{"cpu.max": "max"},
+		},
+		{
+			name: "burst and idle",
+			resources: &specs.LinuxResources{
+				CPU: &specs.LinuxCPU{Burst: uint64Ptr(10000), Idle: int64Ptr(1)},
+			},
+			want: map[string]string{"cpu.max.burst": "10000", "cpu.idle": "1"},
+		},
+		{
+			name: "pids limit",
+			resources: &specs.LinuxResources{
+				Pids: &specs.LinuxPids{Limit: 64},
+			},
+			want: map[string]string{"pids.max": "64"},
+		},
+		{
+			name: "unlimited pids",
+			resources: &specs.LinuxResources{
+				Pids: &specs.LinuxPids{Limit: -1},
+			},
+			want: map[string]string{"pids.max": "max"},
+		},
+		{
+			name: "blkio weight converts to io.weight",
+			resources: &specs.LinuxResources{
+				BlockIO: &specs.LinuxBlockIO{Weight: uint16Ptr(500)},
+			},
+			want: map[string]string{"io.weight": "default 4950"},
+		},
+		{
+			name: "throttle devices merge into one io.max line",
+			resources: &specs.LinuxResources{
+				BlockIO: &specs.LinuxBlockIO{
+					ThrottleReadBpsDevice:   []specs.LinuxThrottleDevice{throttleDevice(8, 0, 1048576)},
+					ThrottleWriteIOPSDevice: []specs.LinuxThrottleDevice{throttleDevice(8, 0, 100)},
+					ThrottleReadIOPSDevice:  []specs.LinuxThrottleDevice{throttleDevice(8, 0, 0)},
+				},
+			},
+			want: map[string]string{"io.max": "8:0 rbps=1048576 riops=max wiops=100"},
+		},
+		{
+			name: "rdma limits are keyed by device",
+			resources: &specs.LinuxResources{
+				Rdma: map[string]specs.LinuxRdma{
+					"mlx5_0": {HcaHandles: uint32Ptr(3)},
+				},
+			},
+			want: map[string]string{"rdma.max": "mlx5_0 hca_handle=3 hca_object=max"},
+		},
+		{
+			name: "malformed unified misc.max",
+			resources: &specs.LinuxResources{
+				Unified: map[string]string{"misc.max": "sev lots"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero pids limit is unset",
+			resources: &specs.LinuxResources{
+				Pids: &specs.LinuxPids{Limit: 0},
+			},
+			want: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &specs.Spec{Linux: &specs.Linux{Resources: tt.resources}}
+
+			subSystems, err := createCgroupSubSystems(spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			dir := t.TempDir()
+			for _, s := range subSystems {
+				if err := s.Apply(cgroup.OSFileSystem{}, dir); err != nil {
+					t.Fatalf("%s apply failed: %v", s.Name(), err)
+				}
+			}
+
+			if got := readCgroupDir(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cgroup files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func readCgroupDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read cgroup directory: %v", err)
+	}
+
+	files := make(map[string]string)
+	for _, e := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", e.Name(), err)
+		}
+		files[e.Name()] = string(content)
+	}
+	return files
+}
+
+func TestDefaultSpec(t *testing.T) {
+	for _, rootless := range []bool{false, true} {
+		spec := DefaultSpec(rootless)
+		if err := Validate(spec); err != nil {
+			t.Errorf("DefaultSpec(%v) is invalid: %v", rootless, err)
+		}
+		if !spec.Root.Readonly {
+			t.Errorf("DefaultSpec(%v) root is writable, want read-only", rootless)
+		}
+		sets, err := parseCapabilities(spec.Process.Capabilities)
+		if err != nil {
+			t.Fatalf("DefaultSpec(%v) capabilities: %v", rootless, err)
+		}
+		if sets.bounding == 0 || sets.effective != sets.bounding || sets.permitted != sets.bounding {
+			t.Errorf("DefaultSpec(%v) capabilities = %+v, want the same non-empty bounding, effective and permitted sets", rootless, sets)
+		}
+		if got := hasNamespace(spec, specs.UserNamespace); got != rootless {
+			t.Errorf("DefaultSpec(%v) has a user namespace = %v", rootless, got)
+		}
+	}
+}
+
+func TestToRootless(t *testing.T) {
+	spec := DefaultSpec(false)
+	toRootless(spec, 1000, 100)
+
+	var namespaces []specs.LinuxNamespaceType
+	for _, ns := range spec.Linux.Namespaces {
+		namespaces = append(namespaces, ns.Type)
+	}
+	wantNamespaces := []specs.LinuxNamespaceType{
+		specs.PIDNamespace, specs.IPCNamespace, specs.UTSNamespace, specs.MountNamespace, specs.CgroupNamespace, specs.UserNamespace,
+	}
+	if !reflect.DeepEqual(namespaces, wantNamespaces) {
+		t.Errorf("namespaces = %v, want %v", namespaces, wantNamespaces)
+	}
+
+	wantUIDs := []specs.LinuxIDMapping{{ContainerID: 0, HostID: 1000, Size: 1}}
+	wantGIDs := []specs.LinuxIDMapping{{ContainerID: 0, HostID: 100, Size: 1}}
+	if !reflect.DeepEqual(spec.Linux.UIDMappings, wantUIDs) || !reflect.DeepEqual(spec.Linux.GIDMappings, wantGIDs) {
+		t.Errorf("mappings = %v, %v, want %v, %v", spec.Linux.UIDMappings, spec.Linux.GIDMappings, wantUIDs, wantGIDs)
+	}
+
+	mounts := make(map[string]specs.Mount)
+	for _, m := range spec.Mounts {
+		mounts[m.Destination] = m
+		for _, o := range m.Options {
+			if strings.HasPrefix(o, "uid=") || strings.HasPrefix(o, "gid=") {
+				t.Errorf("mount %s keeps option %s, which names an unmapped ID", m.Destination, o)
+			}
+		}
+	}
+	if _, ok := mounts["/sys/fs/cgroup"]; ok {
+		t.Error("rootless spec mounts /sys/fs/cgroup")
+	}
+	wantSys := specs.Mount{Destination: "/sys", Type: "none", Source: "/sys", Options: []string{"rbind", "nosuid", "noexec", "nodev", "ro"}}
+	if !reflect.DeepEqual(mounts["/sys"], wantSys) {
+		t.Errorf("/sys mount = %+v, want %+v", mounts["/sys"], wantSys)
+	}
+	if spec.Linux.Resources != nil {
+		t.Errorf("resources = %+v, want none", spec.Linux.Resources)
+	}
+
+	// Converting twice must not add a second user namespace.
+	toRootless(spec, 1000, 100)
+	if got := len(spec.Linux.Namespaces); got != len(wantNamespaces) {
+		t.Errorf("%d namespaces after converting twice, want %d", got, len(wantNamespaces))
+	}
+}
+
+func TestWriteSpec(t *testing.T) {
+	bundle := t.TempDir()
+	spec := DefaultSpec(false)
+	if err := WriteSpec(bundle, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadSpec(filepath.Join(bundle, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, spec) {
+		t.Errorf("written spec = %+v, want %+v", got, spec)
+	}
+
+	if err := WriteSpec(bundle, DefaultSpec(true)); err == nil {
+		t.Error("WriteSpec overwrote an existing config.json")
+	}
+	if got, err := loadSpec(filepath.Join(bundle, "config.json")); err != nil || hasNamespace(got, specs.UserNamespace) {
+		t.Errorf("config.json changed after a refused write: %v", err)
+	}
+}
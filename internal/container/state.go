@@ -2,35 +2,139 @@ package container
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"syscall"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
-const containeruntimeStateDir = "/run/containeruntime"
+// defaultStateDir holds a state directory for every container of the root user.
+const defaultStateDir = "/run/containeruntime"
+
+// containeruntimeStateDir, when set, replaces the state directory chosen by stateDir.
+var containeruntimeStateDir string
+
+// Files in the state directory of a container, <state dir>/<id>/.
+const (
+	stateFilename = "state.json"
+	// lockFilename is the file whose flock serializes the lifecycle operations
+	// on a container.
+	lockFilename = "lock"
+	// execFIFOFilename is the FIFO that init blocks on until the container is started.
+	execFIFOFilename = "exec.fifo"
+	// logFilename collects the messages of the container's init process
+	// until it executes the container process.
+	logFilename = "log"
+)
+
+const (
+	// cgroupPathAnnotation records the path of the container cgroup in its state.
+	cgroupPathAnnotation = "containeruntime/cgroup-path"
+	// systemdUnitAnnotation records the scope unit of a container whose cgroup
+	// is managed through systemd.
+	systemdUnitAnnotation = "containeruntime/systemd-unit"
+)
 
-// InitStateDir initializes the state directory for container runtime.
-func InitStateDir() error {
-	if err := os.MkdirAll(containeruntimeStateDir, 0o750); err != nil {
-		return fmt.Errorf("container: failed to create state directory: %w", err)
+// stateDir returns the directory holding the state directories of the
+// containers. Unprivileged users cannot write to /run, so their containers are
+// kept in $XDG_RUNTIME_DIR/containeruntime instead.
+func stateDir() (string, error) {
+	if containeruntimeStateDir != "" {
+		return containeruntimeStateDir, nil
 	}
-	return nil
+	return stateDirFor(os.Geteuid(), os.Getenv("XDG_RUNTIME_DIR"))
+}
+
+func stateDirFor(euid int, runtimeDir string) (string, error) {
+	if euid == 0 {
+		return defaultStateDir, nil
+	}
+	if runtimeDir == "" {
+		return "", errors.New("container: XDG_RUNTIME_DIR must be set to keep the state of rootless containers")
+	}
+	return filepath.Join(runtimeDir, "containeruntime"), nil
+}
+
+// containerDir returns the state directory of a container. Every access to a
+// container's files goes through it, so it is where container IDs are validated.
+func containerDir(containerID string) (string, error) {
+	if err := ValidateID(containerID); err != nil {
+		return "", err
+	}
+	root, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, containerID), nil
 }
 
-func getStatePath(containerID string) string {
-	return filepath.Join(containeruntimeStateDir, containerID+".json")
+// createContainerDir creates the state directory of a new container and takes
+// its lock. It fails if the container already exists.
+func createContainerDir(containerID string) (unlock func(), err error) {
+	dir, err := containerDir(containerID)
+	if err != nil {
+		return nil, err
+	}
+	// The state directory is only created once a container is.
+	if err := os.MkdirAll(filepath.Dir(dir), 0o750); err != nil {
+		return nil, fmt.Errorf("container: failed to create state directory: %w", err)
+	}
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("container: container %s already exists", containerID)
+		}
+		return nil, fmt.Errorf("container: failed to create state directory for container %s: %w", containerID, err)
+	}
+	return lockContainer(containerID, syscall.LOCK_EX)
 }
 
+// lockContainer takes the lock of a container's state directory, waiting for
+// the lifecycle operations holding it to finish. Operations that change the
+// container take it with LOCK_EX; those that only read its state with LOCK_SH.
+func lockContainer(containerID string, how int) (unlock func(), err error) {
+	dir, err := containerDir(containerID)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, lockFilename), os.O_RDONLY|os.O_CREATE, 0o600)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("container: container %s does not exist", containerID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("container: failed to open lock file for container %s: %w", containerID, err)
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("container: failed to lock container %s: %w", containerID, err)
+	}
+	// Closing the file releases the lock.
+	return func() { f.Close() }, nil
+}
+
+func getStatePath(containerID string) (string, error) {
+	dir, err := containerDir(containerID)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, stateFilename), nil
+}
+
+// saveState replaces the state file of a container. The new state is written
+// to a uniquely named temporary file first, so readers never see a partial state.
 func saveState(state *specs.State) error {
-	statePath := getStatePath(state.ID)
-	tempPath := statePath + ".tmp"
+	statePath, err := getStatePath(state.ID)
+	if err != nil {
+		return err
+	}
 
-	f, err := os.Create(tempPath)
+	f, err := os.CreateTemp(filepath.Dir(statePath), stateFilename+".*.tmp")
 	if err != nil {
 		return fmt.Errorf("container: failed to create temporary state file: %w", err)
 	}
+	tempPath := f.Name()
 	defer f.Close()
 	defer os.Remove(tempPath)
 
@@ -51,7 +155,10 @@ func saveState(state *specs.State) error {
 }
 
 func loadState(containerID string) (*specs.State, error) {
-	statePath := getStatePath(containerID)
+	statePath, err := getStatePath(containerID)
+	if err != nil {
+		return nil, err
+	}
 	state := &specs.State{}
 
 	f, err := os.Open(statePath)
@@ -67,10 +174,15 @@ func loadState(containerID string) (*specs.State, error) {
 	return state, nil
 }
 
+// deleteState removes the state directory of a container, together with its
+// lock file. Operations waiting for the lock then find no state.
 func deleteState(containerID string) error {
-	statePath := getStatePath(containerID)
-	if err := os.Remove(statePath); err != nil {
-		return fmt.Errorf("container: failed to delete state file for container %s: %w", containerID, err)
+	dir, err := containerDir(containerID)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("container: failed to delete state of container %s: %w", containerID, err)
 	}
 	return nil
 }
@@ -86,10 +198,3 @@ func newContainerState(id, bundlePath string) *specs.State {
 	}
 	return state
 }
-
-func SetContainerState(containerID string, state *specs.State) error {
-	if err := saveState(state); err != nil {
-		return fmt.Errorf("container: failed to update state for container %s: %w", containerID, err)
-	}
-	return nil
-}
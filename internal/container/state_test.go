@@ -0,0 +1,176 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func useStateDir(t *testing.T) {
+	t.Helper()
+	previous := containeruntimeStateDir
+	containeruntimeStateDir = t.TempDir()
+	t.Cleanup(func() { containeruntimeStateDir = previous })
+}
+
+func TestContainerDirLifecycle(t *testing.T) {
+	useStateDir(t)
+
+	unlock, err := createContainerDir("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := newContainerState("abc", "/bundle")
+	if err := saveState(state); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	if _, err := createContainerDir("abc"); err == nil {
+		t.Error("created the state directory of an existing container")
+	}
+	loaded, err := loadState("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Bundle != "/bundle" {
+		t.Errorf("loaded bundle = %q, want /bundle", loaded.Bundle)
+	}
+	if _, err := os.Stat(filepath.Join(containeruntimeStateDir, "abc", stateFilename)); err != nil {
+		t.Errorf("state file: %v", err)
+	}
+
+	if err := deleteState("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockContainer("abc", syscall.LOCK_SH); err == nil {
+		t.Error("locked a deleted container")
+	}
+}
+
+func TestLockContainerSerializesOperations(t *testing.T) {
+	useStateDir(t)
+	unlock, err := createContainerDir("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan func())
+	go func() {
+		unlock, err := lockContainer("abc", syscall.LOCK_SH)
+		if err != nil {
+			t.Error(err)
+			close(locked)
+			return
+		}
+		locked <- unlock
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("took a shared lock while an exclusive one was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case unlock := <-locked:
+		if unlock != nil {
+			unlock()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock was not released")
+	}
+}
+
+func TestSaveStateConcurrently(t *testing.T) {
+	useStateDir(t)
+	unlock, err := createContainerDir("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			state := newContainerState("abc", "/bundle")
+			state.Pid = i
+			for range 20 {
+				if err := saveState(state); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := loadState("abc"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(filepath.Join(containeruntimeStateDir, "abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != stateFilename && entry.Name() != lockFilename {
+			t.Errorf("leftover file %s", entry.Name())
+		}
+	}
+}
+
+func TestStateDirFor(t *testing.T) {
+	tests := []struct {
+		euid       int
+		runtimeDir string
+		want       string
+		wantErr    bool
+	}{
+		{euid: 0, runtimeDir: "/run/user/0", want: "/run/containeruntime"},
+		{euid: 1000, runtimeDir: "/run/user/1000", want: "/run/user/1000/containeruntime"},
+		{euid: 1000, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := stateDirFor(tt.euid, tt.runtimeDir)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("stateDirFor(%d, %q) = %q, %v, want %q (error %t)", tt.euid, tt.runtimeDir, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestContainerWithoutProcess(t *testing.T) {
+	useStateDir(t)
+	unlock, err := createContainerDir("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A create that failed before init was started leaves a state without a pid.
+	if err := saveState(newContainerState("abc", "/bundle")); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	state, err := State("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Status != specs.StateStopped {
+		t.Errorf("status = %s, want stopped", state.Status)
+	}
+	if err := Kill("abc", syscall.SIGKILL); err == nil {
+		t.Error("Kill signalled a container without a process")
+	}
+	if err := Delete("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadState("abc"); err == nil {
+		t.Error("the state was not deleted")
+	}
+}
@@ -0,0 +1,411 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+	"github.com/yoonhyunwoo/containeruntime/internal/linux/timens"
+)
+
+// minOCIVersion is the oldest OCI runtime spec version the runtime accepts.
+const minOCIVersion = "1.0.0"
+
+// ValidationError describes a single problem found in a spec.
+type ValidationError struct {
+	// Path is the JSON path of the offending field, such as "linux.namespaces[1].type".
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors is the list of every problem found in a spec.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return "container: invalid spec: " + strings.Join(messages, "; ")
+}
+
+type specValidator struct {
+	errs ValidationErrors
+}
+
+func (v *specValidator) addf(path, format string, args ...any) {
+	v.errs = append(v.errs, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateBundle loads config.json from the bundle and validates it, including
+// the existence of the root filesystem.
+func ValidateBundle(bundlePath string) error {
+	spec, err := loadSpec(filepath.Join(bundlePath, "config.json"))
+	if err != nil {
+		return err
+	}
+	return validateBundleSpec(bundlePath, spec)
+}
+
+func validateBundleSpec(bundlePath string, spec *specs.Spec) error {
+	validateErr := Validate(spec)
+
+	var errs ValidationErrors
+	if validateErr != nil && !errors.As(validateErr, &errs) {
+		return validateErr
+	}
+	if spec.Root != nil && spec.Root.Path != "" {
+		rootPath := spec.Root.Path
+		if !filepath.IsAbs(rootPath) {
+			rootPath = filepath.Join(bundlePath, rootPath)
+		}
+		if info, statErr := os.Stat(rootPath); statErr != nil {
+			errs = append(errs, &ValidationError{Path: "root.path", Message: statErr.Error()})
+		} else if !info.IsDir() {
+			errs = append(errs, &ValidationError{Path: "root.path", Message: rootPath + " is not a directory"})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate checks a spec for problems that would make the runtime fail or
+// misbehave, and returns all of them as ValidationErrors.
+func Validate(spec *specs.Spec) error {
+	v := &specValidator{}
+	v.validateVersion(spec.Version)
+	v.validateRoot(spec.Root)
+	v.validateProcess(spec.Process)
+	v.validateMounts(spec.Mounts)
+	v.validateHooks(spec.Hooks)
+	v.validateLinux(spec)
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+func (v *specValidator) validateVersion(version string) {
+	if version == "" {
+		v.addf("ociVersion", "is required")
+		return
+	}
+
+	parsed, ok := parseVersion(version)
+	if !ok {
+		v.addf("ociVersion", "%q is not a valid semantic version", version)
+		return
+	}
+	minVersion, _ := parseVersion(minOCIVersion)
+	maxVersion, _ := parseVersion(specs.Version)
+	if compareVersions(parsed, minVersion) < 0 || compareVersions(parsed, maxVersion) > 0 {
+		v.addf("ociVersion", "%s is not supported, want between %s and %s", version, minOCIVersion, specs.Version)
+	}
+}
+
+func (v *specValidator) validateRoot(root *specs.Root) {
+	if root == nil {
+		v.addf("root", "is required")
+		return
+	}
+	if root.Path == "" {
+		v.addf("root.path", "is required")
+	}
+}
+
+func (v *specValidator) validateProcess(process *specs.Process) {
+	if process == nil {
+		v.addf("process", "is required")
+		return
+	}
+	if len(process.Args) == 0 {
+		v.addf("process.args", "must contain at least one entry")
+	}
+	if !filepath.IsAbs(process.Cwd) {
+		v.addf("process.cwd", "%q must be an absolute path", process.Cwd)
+	}
+	for i, env := range process.Env {
+		if !strings.Contains(env, "=") {
+			v.addf(fmt.Sprintf("process.env[%d]", i), "%q must be in KEY=value form", env)
+		}
+	}
+	for i, rlimit := range process.Rlimits {
+		path := fmt.Sprintf("process.rlimits[%d]", i)
+		if _, ok := rlimitResources[rlimit.Type]; !ok {
+			v.addf(path+".type", "unsupported rlimit %q", rlimit.Type)
+		}
+		if rlimit.Soft > rlimit.Hard {
+			v.addf(path+".soft", "must not exceed the hard limit %d", rlimit.Hard)
+		}
+	}
+	if caps := process.Capabilities; caps != nil {
+		for _, set := range []struct {
+			name  string
+			names []string
+		}{
+			{"bounding", caps.Bounding},
+			{"effective", caps.Effective},
+			{"permitted", caps.Permitted},
+			{"inheritable", caps.Inheritable},
+			{"ambient", caps.Ambient},
+		} {
+			for i, name := range set.names {
+				if !slices.Contains(capabilityNames, name) {
+					v.addf(fmt.Sprintf("process.capabilities.%s[%d]", set.name, i), "unknown capability %q", name)
+				}
+			}
+		}
+	}
+}
+
+func (v *specValidator) validateMounts(mounts []specs.Mount) {
+	for i, m := range mounts {
+		path := fmt.Sprintf("mounts[%d]", i)
+		if !filepath.IsAbs(m.Destination) {
+			v.addf(path+".destination", "%q must be an absolute path", m.Destination)
+		}
+
+		flags, _ := parseMountOptions(m.Options)
+		if (m.Type == "bind" || flags&mountFlags["bind"].flag != 0) && m.Source == "" {
+			v.addf(path+".source", "is required for bind mounts")
+		}
+	}
+}
+
+// validateHooks rejects hooks, which the runtime does not run.
+func (v *specValidator) validateHooks(hooks *specs.Hooks) {
+	if hooks == nil {
+		return
+	}
+	for _, set := range []struct {
+		name  string
+		hooks []specs.Hook
+	}{
+		{"prestart", hooks.Prestart},
+		{"createRuntime", hooks.CreateRuntime},
+		{"createContainer", hooks.CreateContainer},
+		{"startContainer", hooks.StartContainer},
+		{"poststart", hooks.Poststart},
+		{"poststop", hooks.Poststop},
+	} {
+		if len(set.hooks) > 0 {
+			v.addf("hooks."+set.name, "is not supported")
+		}
+	}
+}
+
+func (v *specValidator) validateLinux(spec *specs.Spec) {
+	linux := spec.Linux
+	if linux == nil {
+		v.addf("linux", "is required")
+		return
+	}
+
+	namespaces := make(map[specs.LinuxNamespaceType]bool)
+	for i, ns := range linux.Namespaces {
+		path := fmt.Sprintf("linux.namespaces[%d]", i)
+		if _, ok := namespaceCloneFlags[ns.Type]; !ok {
+			v.addf(path+".type", "unsupported namespace type %q", ns.Type)
+		}
+		if namespaces[ns.Type] {
+			v.addf(path+".type", "duplicate namespace type %q", ns.Type)
+		}
+		namespaces[ns.Type] = true
+		// Joining an existing namespace needs setns(2), which init does not do.
+		if ns.Path != "" {
+			v.addf(path+".path", "joining an existing namespace is not supported")
+		}
+	}
+
+	if spec.Hostname != "" && !namespaces[specs.UTSNamespace] {
+		v.addf("hostname", "requires a uts namespace")
+	}
+	if spec.Domainname != "" && !namespaces[specs.UTSNamespace] {
+		v.addf("domainname", "requires a uts namespace")
+	}
+
+	for _, mappings := range []struct {
+		path     string
+		mappings []specs.LinuxIDMapping
+	}{
+		{"linux.uidMappings", linux.UIDMappings},
+		{"linux.gidMappings", linux.GIDMappings},
+	} {
+		switch {
+		case len(mappings.mappings) > 0 && !namespaces[specs.UserNamespace]:
+			v.addf(mappings.path, "requires a user namespace")
+		case len(mappings.mappings) == 0 && namespaces[specs.UserNamespace]:
+			v.addf(mappings.path, "is required with a user namespace")
+		}
+	}
+
+	if len(linux.TimeOffsets) > 0 {
+		if !namespaces[specs.TimeNamespace] {
+			v.addf("linux.timeOffsets", "requires a time namespace")
+		}
+		for clock, offset := range linux.TimeOffsets {
+			path := "linux.timeOffsets." + clock
+			if !slices.Contains(timens.Clocks, clock) {
+				v.addf(path, "unsupported clock, want one of %s", strings.Join(timens.Clocks, ", "))
+			}
+			if offset.Nanosecs >= 1_000_000_000 {
+				v.addf(path+".nanosecs", "must be less than 1000000000")
+			}
+		}
+	}
+
+	for i, p := range linux.MaskedPaths {
+		if !filepath.IsAbs(p) {
+			v.addf(fmt.Sprintf("linux.maskedPaths[%d]", i), "%q must be an absolute path", p)
+		}
+	}
+	for i, p := range linux.ReadonlyPaths {
+		if !filepath.IsAbs(p) {
+			v.addf(fmt.Sprintf("linux.readonlyPaths[%d]", i), "%q must be an absolute path", p)
+		}
+	}
+
+	if linux.Resources != nil {
+		v.validateResources(linux.Resources)
+	}
+}
+
+func (v *specValidator) validateResources(resources *specs.LinuxResources) {
+	for i, dev := range resources.Devices {
+		path := fmt.Sprintf("linux.resources.devices[%d]", i)
+		if dev.Type != "" && dev.Type != "a" && dev.Type != "b" && dev.Type != "c" {
+			v.addf(path+".type", "%q must be one of a, b or c", dev.Type)
+		}
+		if strings.Trim(dev.Access, "rwm") != "" {
+			v.addf(path+".access", "%q must only contain r, w and m", dev.Access)
+		}
+	}
+
+	if mem := resources.Memory; mem != nil {
+		v.checkMemoryValue("linux.resources.memory.limit", mem.Limit)
+		v.checkMemoryValue("linux.resources.memory.reservation", mem.Reservation)
+		v.checkMemoryValue("linux.resources.memory.swap", mem.Swap)
+		if mem.Limit != nil && mem.Swap != nil && *mem.Limit > 0 && *mem.Swap > 0 && *mem.Swap < *mem.Limit {
+			v.addf("linux.resources.memory.swap", "must not be less than linux.resources.memory.limit, as it includes memory")
+		}
+		if mem.Swappiness != nil && *mem.Swappiness > 100 {
+			v.addf("linux.resources.memory.swappiness", "must be between 0 and 100")
+		}
+	}
+
+	// Zero leaves a value unset, as it does when the resources are applied.
+	if cpu := resources.CPU; cpu != nil {
+		if cpu.Shares != nil && *cpu.Shares != 0 && (*cpu.Shares < 2 || *cpu.Shares > 262144) {
+			v.addf("linux.resources.cpu.shares", "must be 0 or between 2 and 262144")
+		}
+		if cpu.Quota != nil && *cpu.Quota < -1 {
+			v.addf("linux.resources.cpu.quota", "must be positive, 0 or -1 for no limit")
+		}
+		if cpu.Period != nil && *cpu.Period != 0 && (*cpu.Period < 1000 || *cpu.Period > 1000000) {
+			v.addf("linux.resources.cpu.period", "must be 0 or between 1000 and 1000000")
+		}
+		if cpu.Idle != nil && *cpu.Idle != 0 && *cpu.Idle != 1 {
+			v.addf("linux.resources.cpu.idle", "must be 0 or 1")
+		}
+		if _, err := cgroup.ParseList(cpu.Cpus); err != nil {
+			v.addf("linux.resources.cpu.cpus", "%v", err)
+		}
+		if _, err := cgroup.ParseList(cpu.Mems); err != nil {
+			v.addf("linux.resources.cpu.mems", "%v", err)
+		}
+	}
+
+	if pids := resources.Pids; pids != nil && pids.Limit < -1 {
+		v.addf("linux.resources.pids.limit", "must not be less than -1")
+	}
+
+	if blockIO := resources.BlockIO; blockIO != nil {
+		if !validBlkIOWeight(blockIO.Weight) {
+			v.addf("linux.resources.blockIO.weight", "must be 0 or between 10 and 1000")
+		}
+		for i, dev := range blockIO.WeightDevice {
+			if !validBlkIOWeight(dev.Weight) {
+				v.addf(fmt.Sprintf("linux.resources.blockIO.weightDevice[%d].weight", i), "must be 0 or between 10 and 1000")
+			}
+		}
+	}
+
+	for key := range resources.Unified {
+		if err := cgroup.ValidateUnifiedKey(key); err != nil {
+			v.addf("linux.resources.unified."+key, "%v", err)
+		}
+	}
+	if value, ok := resources.Unified[miscMaxKey]; ok {
+		if _, err := cgroup.ParseMiscMax(value); err != nil {
+			v.addf("linux.resources.unified."+miscMaxKey, "%v", err)
+		}
+	}
+
+	pageSizes := make(map[string]int)
+	for i, hugepage := range resources.HugepageLimits {
+		path := fmt.Sprintf("linux.resources.hugepageLimits[%d].pageSize", i)
+		pageSize, err := cgroup.NormalizePageSize(hugepage.Pagesize)
+		if err != nil {
+			v.addf(path, "%v", err)
+			continue
+		}
+		if j, ok := pageSizes[pageSize]; ok {
+			v.addf(path, "page size %s is already limited by hugepageLimits[%d]", pageSize, j)
+			continue
+		}
+		pageSizes[pageSize] = i
+	}
+}
+
+// validBlkIOWeight reports whether weight is unset, 0 or a valid blkio weight.
+func validBlkIOWeight(weight *uint16) bool {
+	return weight == nil || *weight == 0 || (*weight >= 10 && *weight <= 1000)
+}
+
+func (v *specValidator) checkMemoryValue(path string, value *int64) {
+	if value != nil && *value < -1 {
+		v.addf(path, "must not be less than -1")
+	}
+}
+
+// parseVersion parses a semantic version such as "1.0.2" or "1.2.0-rc.1".
+func parseVersion(version string) ([3]int, bool) {
+	var parsed [3]int
+	core, _, _ := strings.Cut(version, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return parsed, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return parsed, false
+		}
+		parsed[i] = n
+	}
+	return parsed, true
+}
+
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return 0
+}
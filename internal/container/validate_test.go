@@ -0,0 +1,348 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func validTestSpec() *specs.Spec {
+	return &specs.Spec{
+		Version: specs.Version,
+		Root:    &specs.Root{Path: "rootfs"},
+		Process: &specs.Process{Args: []string{"sh"}, Cwd: "/", Env: []string{"PATH=/bin"}},
+		Linux: &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{{Type: specs.PIDNamespace}, {Type: specs.MountNamespace}},
+		},
+	}
+}
+
+func withResources(spec *specs.Spec, resources *specs.LinuxResources) {
+	spec.Linux.Resources = resources
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*specs.Spec)
+		// want lists the paths of the expected errors, in order.
+		want []string
+	}{
+		{
+			name:   "valid spec",
+			modify: func(*specs.Spec) {},
+		},
+		{
+			name:   "missing version",
+			modify: func(s *specs.Spec) { s.Version = "" },
+			want:   []string{"ociVersion"},
+		},
+		{
+			name:   "malformed version",
+			modify: func(s *specs.Spec) { s.Version = "1.0" },
+			want:   []string{"ociVersion"},
+		},
+		{
+			name:   "unsupported version",
+			modify: func(s *specs.Spec) { s.Version = "0.9.0" },
+			want:   []string{"ociVersion"},
+		},
+		{
+			name:   "missing root path",
+			modify: func(s *specs.Spec) { s.Root.Path = "" },
+			want:   []string{"root.path"},
+		},
+		{
+			name: "invalid process",
+			modify: func(s *specs.Spec) {
+				s.Process.Args = nil
+				s.Process.Cwd = "tmp"
+				s.Process.Env = []string{"PATH=/bin", "HOME"}
+			},
+			want: []string{"process.args", "process.cwd", "process.env[1]"},
+		},
+		{
+			name: "invalid rlimits",
+			modify: func(s *specs.Spec) {
+				s.Process.Rlimits = []specs.POSIXRlimit{
+					{Type: "RLIMIT_NOFILE", Hard: 1024, Soft: 1024},
+					{Type: "RLIMIT_BOGUS", Hard: 1, Soft: 1},
+					{Type: "RLIMIT_NPROC", Hard: 10, Soft: 11},
+				}
+			},
+			want: []string{"process.rlimits[1].type", "process.rlimits[2].soft"},
+		},
+		{
+			name: "unknown capabilities",
+			modify: func(s *specs.Spec) {
+				s.Process.Capabilities = &specs.LinuxCapabilities{
+					Bounding: []string{"CAP_KILL", "CAP_BOGUS"},
+					Ambient:  []string{"kill"},
+				}
+			},
+			want: []string{"process.capabilities.bounding[1]", "process.capabilities.ambient[0]"},
+		},
+		{
+			name: "invalid mounts",
+			modify: func(s *specs.Spec) {
+				s.Mounts = []specs.Mount{
+					{Destination: "/proc", Type: "proc", Source: "proc"},
+					{Destination: "data", Type: "bind", Source: "/data"},
+					{Destination: "/etc/hosts", Options: []string{"rbind", "ro"}},
+				}
+			},
+			want: []string{"mounts[1].destination", "mounts[2].source"},
+		},
+		{
+			name: "hooks are not supported",
+			modify: func(s *specs.Spec) {
+				s.Hooks = &specs.Hooks{
+					CreateRuntime:  []specs.Hook{{Path: "/bin/true"}},
+					StartContainer: []specs.Hook{{Path: "/bin/true"}},
+					Poststop:       []specs.Hook{{Path: "/bin/true"}},
+				}
+			},
+			want: []string{"hooks.createRuntime", "hooks.startContainer", "hooks.poststop"},
+		},
+		{
+			name:   "missing linux",
+			modify: func(s *specs.Spec) { s.Linux = nil },
+			want:   []string{"linux"},
+		},
+		{
+			name: "invalid namespaces",
+			modify: func(s *specs.Spec) {
+				s.Linux.Namespaces = append(s.Linux.Namespaces,
+					specs.LinuxNamespace{Type: "bogus"},
+					specs.LinuxNamespace{Type: specs.PIDNamespace},
+				)
+			},
+			want: []string{"linux.namespaces[2].type", "linux.namespaces[3].type"},
+		},
+		{
+			name: "joining a namespace",
+			modify: func(s *specs.Spec) {
+				s.Linux.Namespaces = append(s.Linux.Namespaces, specs.LinuxNamespace{Type: specs.NetworkNamespace, Path: "/proc/1/ns/net"})
+			},
+			want: []string{"linux.namespaces[2].path"},
+		},
+		{
+			name: "hostname without uts namespace",
+			modify: func(s *specs.Spec) {
+				s.Hostname = "ctr"
+				s.Domainname = "example.com"
+			},
+			want: []string{"hostname", "domainname"},
+		},
+		{
+			name: "uid mappings without user namespace",
+			modify: func(s *specs.Spec) {
+				s.Linux.UIDMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: 1000, Size: 1}}
+			},
+			want: []string{"linux.uidMappings"},
+		},
+		{
+			name: "gid mappings without user namespace",
+			modify: func(s *specs.Spec) {
+				s.Linux.GIDMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: 1000, Size: 1}}
+			},
+			want: []string{"linux.gidMappings"},
+		},
+		{
+			name: "user namespace without mappings",
+			modify: func(s *specs.Spec) {
+				s.Linux.Namespaces = append(s.Linux.Namespaces, specs.LinuxNamespace{Type: specs.UserNamespace})
+			},
+			want: []string{"linux.uidMappings", "linux.gidMappings"},
+		},
+		{
+			name: "user namespace with only uid mappings",
+			modify: func(s *specs.Spec) {
+				s.Linux.Namespaces = append(s.Linux.Namespaces, specs.LinuxNamespace{Type: specs.UserNamespace})
+				s.Linux.UIDMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: 1000, Size: 1}}
+			},
+			want: []string{"linux.gidMappings"},
+		},
+		{
+			name: "user namespace with mappings",
+			modify: func(s *specs.Spec) {
+				s.Linux.Namespaces = append(s.Linux.Namespaces, specs.LinuxNamespace{Type: specs.UserNamespace})
+				s.Linux.UIDMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: 1000, Size: 1}}
+				s.Linux.GIDMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: 1000, Size: 1}}
+			},
+		},
+		{
+			name: "invalid time offsets",
+			modify: func(s *specs.Spec) {
+				s.Linux.TimeOffsets = map[string]specs.LinuxTimeOffset{"realtime": {Nanosecs: 1_000_000_000}}
+			},
+			want: []string{"linux.timeOffsets", "linux.timeOffsets.realtime", "linux.timeOffsets.realtime.nanosecs"},
+		},
+		{
+			name: "relative masked and readonly paths",
+			modify: func(s *specs.Spec) {
+				s.Linux.MaskedPaths = []string{"/proc/kcore", "proc/keys"}
+				s.Linux.ReadonlyPaths = []string{"proc/sys"}
+			},
+			want: []string{"linux.maskedPaths[1]", "linux.readonlyPaths[0]"},
+		},
+		{
+			name: "invalid devices",
+			modify: func(s *specs.Spec) {
+				withResources(s, &specs.LinuxResources{Devices: []specs.LinuxDeviceCgroup{
+					{Allow: true, Type: "c", Access: "rwm"},
+					{Allow: false, Type: "x", Access: "rwx"},
+				}})
+			},
+			want: []string{"linux.resources.devices[1].type", "linux.resources.devices[1].access"},
+		},
+		{
+			name: "invalid memory",
+			modify: func(s *specs.Spec) {
+				withResources(s, &specs.LinuxResources{Memory: &specs.LinuxMemory{
+					Limit:       int64Ptr(256 << 20),
+					Reservation: int64Ptr(-2),
+					Swap:        int64Ptr(128 << 20),
+					Swappiness:  uint64Ptr(101),
+				}})
+			},
+			want: []string{"linux.resources.memory.reservation", "linux.resources.memory.swap", "linux.resources.memory.swappiness"},
+		},
+		{
+			name: "zero cpu and blkio values are unset",
+			modify: func(s *specs.Spec) {
+				withResources(s, &specs.LinuxResources{
+					CPU: &specs.LinuxCPU{Shares: uint64Ptr(0), Quota: int64Ptr(0), Period: uint64Ptr(0)},
+					BlockIO: &specs.LinuxBlockIO{
+						Weight:       uint16Ptr(0),
+						WeightDevice: []specs.LinuxWeightDevice{{Weight: uint16Ptr(0)}},
+					},
+				})
+			},
+		},
+		{
+			name: "invalid cpu",
+			modify: func(s *specs.Spec) {
+				withResources(s, &specs.LinuxResources{CPU: &specs.LinuxCPU{
+					Shares: uint64Ptr(1),
+					Quota:  int64Ptr(-2),
+					Period: uint64Ptr(999),
+					Idle:   int64Ptr(2),
+					Cpus:   "0-",
+					Mems:   "1,x",
+				}})
+			},
+			want: []string{
+				"linux.resources.cpu.shares",
+				"linux.resources.cpu.quota",
+				"linux.resources.cpu.period",
+				"linux.resources.cpu.idle",
+				"linux.resources.cpu.cpus",
+				"linux.resources.cpu.mems",
+			},
+		},
+		{
+			name: "invalid pids limit",
+			modify: func(s *specs.Spec) {
+				withResources(s, &specs.LinuxResources{Pids: &specs.LinuxPids{Limit: -2}})
+			},
+			want: []string{"linux.resources.pids.limit"},
+		},
+		{
+			name: "invalid blkio weights",
+			modify: func(s *specs.Spec) {
+				withResources(s, &specs.LinuxResources{BlockIO: &specs.LinuxBlockIO{
+					Weight:       uint16Ptr(5),
+					WeightDevice: []specs.LinuxWeightDevice{{Weight: uint16Ptr(500)}, {Weight: uint16Ptr(1001)}},
+				}})
+			},
+			want: []string{"linux.resources.blockIO.weight", "linux.resources.blockIO.weightDevice[1].weight"},
+		},
+		{
+			name: "invalid unified misc.max",
+			modify: func(s *specs.Spec) {
+				withResources(s, &specs.LinuxResources{Unified: map[string]string{miscMaxKey: "sev"}})
+			},
+			want: []string{"linux.resources.unified.misc.max"},
+		},
+		{
+			name: "invalid and duplicate hugepage sizes",
+			modify: func(s *specs.Spec) {
+				withResources(s, &specs.LinuxResources{HugepageLimits: []specs.LinuxHugepageLimit{
+					{Pagesize: "2MB", Limit: 1 << 21},
+					{Pagesize: "2XB", Limit: 1 << 21},
+					{Pagesize: "2MB", Limit: 1 << 22},
+				}})
+			},
+			want: []string{"linux.resources.hugepageLimits[1].pageSize", "linux.resources.hugepageLimits[2].pageSize"},
+		},
+		{
+			name: "errors accumulate across sections",
+			modify: func(s *specs.Spec) {
+				s.Version = ""
+				s.Process.Cwd = "."
+				s.Hostname = "ctr"
+				withResources(s, &specs.LinuxResources{Pids: &specs.LinuxPids{Limit: -5}})
+			},
+			want: []string{"ociVersion", "process.cwd", "hostname", "linux.resources.pids.limit"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := validTestSpec()
+			tt.modify(spec)
+
+			err := Validate(spec)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+
+			var errs ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Validate() = %v, want ValidationErrors", err)
+			}
+			var paths []string
+			for _, e := range errs {
+				paths = append(paths, e.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.want) {
+				t.Errorf("Validate() error paths = %q, want %q\n%v", paths, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateBundleSpecChecksRoot(t *testing.T) {
+	bundle := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bundle, "rootfs"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := validTestSpec()
+	spec.Process.Args = nil
+	var errs ValidationErrors
+	if err := validateBundleSpec(bundle, spec); !errors.As(err, &errs) {
+		t.Fatalf("validateBundleSpec() = %v, want ValidationErrors", err)
+	}
+	if len(errs) != 2 || errs[0].Path != "process.args" || errs[1].Path != "root.path" {
+		t.Errorf("validateBundleSpec() = %v, want process.args and root.path errors", errs)
+	}
+
+	if err := os.Remove(filepath.Join(bundle, "rootfs")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(bundle, "rootfs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateBundleSpec(bundle, validTestSpec()); err != nil {
+		t.Errorf("validateBundleSpec() with a rootfs directory = %v, want nil", err)
+	}
+}
@@ -0,0 +1,145 @@
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	cgroupv2 "github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+// BlkioSubSystem defines the block I/O settings of the v1 blkio controller.
+// A nil field or missing device leaves the corresponding setting unchanged.
+type BlkioSubSystem struct {
+	// blkio.weight (10 ~ 1000)
+	Weight *uint16
+	// blkio.leaf_weight: the weight of the cgroup's own tasks against its children
+	LeafWeight *uint16
+	// blkio.weight_device
+	WeightDevices map[cgroupv2.IODevice]uint16
+	// blkio.throttle.*_device: bytes or I/O operations per second
+	ThrottleReadBps   map[cgroupv2.IODevice]uint64
+	ThrottleWriteBps  map[cgroupv2.IODevice]uint64
+	ThrottleReadIOps  map[cgroupv2.IODevice]uint64
+	ThrottleWriteIOps map[cgroupv2.IODevice]uint64
+}
+
+func (b *BlkioSubSystem) Name() string {
+	return "blkio"
+}
+
+// Apply applies blkio subsystem settings. Kernels using the BFQ scheduler
+// only provide blkio.bfq.weight, which is used when blkio.weight is missing.
+func (b *BlkioSubSystem) Apply(path string) error {
+	var files []cgroupv2.CgroupFile
+	if b.Weight != nil {
+		filename := "blkio.weight"
+		if _, err := os.Stat(filepath.Join(path, filename)); errors.Is(err, os.ErrNotExist) {
+			filename = "blkio.bfq.weight"
+		}
+		files = append(files, cgroupv2.CgroupFile{Filename: filename, Value: strconv.FormatUint(uint64(*b.Weight), 10)})
+	}
+	if b.LeafWeight != nil {
+		files = append(files, cgroupv2.CgroupFile{Filename: "blkio.leaf_weight", Value: strconv.FormatUint(uint64(*b.LeafWeight), 10)})
+	}
+	for _, dev := range sortedDevices(b.WeightDevices) {
+		files = append(files, cgroupv2.CgroupFile{Filename: "blkio.weight_device", Value: fmt.Sprintf("%s %d", dev, b.WeightDevices[dev])})
+	}
+
+	throttles := []struct {
+		filename string
+		limits   map[cgroupv2.IODevice]uint64
+	}{
+		{"blkio.throttle.read_bps_device", b.ThrottleReadBps},
+		{"blkio.throttle.write_bps_device", b.ThrottleWriteBps},
+		{"blkio.throttle.read_iops_device", b.ThrottleReadIOps},
+		{"blkio.throttle.write_iops_device", b.ThrottleWriteIOps},
+	}
+	for _, t := range throttles {
+		for _, dev := range sortedDevices(t.limits) {
+			files = append(files, cgroupv2.CgroupFile{Filename: t.filename, Value: fmt.Sprintf("%s %d", dev, t.limits[dev])})
+		}
+	}
+
+	// Each device line is a separate write.
+	for _, f := range files {
+		if err := writeFile(path, f.Filename, f.Value); err != nil {
+			return fmt.Errorf("blkio subsystem: failed to set %s: %w", f.Filename, err)
+		}
+	}
+	return nil
+}
+
+// Stat reads the per-device byte and operation counters of the throttling
+// policy, which are kept regardless of the I/O scheduler.
+func (b *BlkioSubSystem) Stat(path string, stats *cgroupv2.Stats) error {
+	devices := make(map[cgroupv2.IODevice]*cgroupv2.IOStat)
+	counters := []struct {
+		filename string
+		fields   func(s *cgroupv2.IOStat) map[string]*uint64
+	}{
+		{"blkio.throttle.io_service_bytes_recursive", func(s *cgroupv2.IOStat) map[string]*uint64 {
+			return map[string]*uint64{"Read": &s.RBytes, "Write": &s.WBytes, "Discard": &s.DBytes}
+		}},
+		{"blkio.throttle.io_serviced_recursive", func(s *cgroupv2.IOStat) map[string]*uint64 {
+			return map[string]*uint64{"Read": &s.RIOs, "Write": &s.WIOs, "Discard": &s.DIOs}
+		}},
+	}
+
+	for _, c := range counters {
+		content, err := readFile(path, c.filename)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("blkio subsystem: failed to read %s: %w", c.filename, err)
+		}
+		// Lines look like "8:0 Read 4096", followed by a "Total" line.
+		for _, line := range strings.Split(content, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				continue
+			}
+			var dev cgroupv2.IODevice
+			if _, err := fmt.Sscanf(fields[0], "%d:%d", &dev.Major, &dev.Minor); err != nil {
+				return fmt.Errorf("blkio subsystem: invalid device %q in %s", fields[0], c.filename)
+			}
+			value, err := strconv.ParseUint(fields[2], 10, 64)
+			if err != nil {
+				return fmt.Errorf("blkio subsystem: failed to parse %s: %w", c.filename, err)
+			}
+			stat, ok := devices[dev]
+			if !ok {
+				stat = &cgroupv2.IOStat{Device: dev}
+				devices[dev] = stat
+			}
+			if field, ok := c.fields(stat)[fields[1]]; ok {
+				*field = value
+			}
+		}
+	}
+
+	stats.IO = nil
+	for _, dev := range sortedDevices(devices) {
+		stats.IO = append(stats.IO, *devices[dev])
+	}
+	return nil
+}
+
+func sortedDevices[V any](m map[cgroupv2.IODevice]V) []cgroupv2.IODevice {
+	devices := make([]cgroupv2.IODevice, 0, len(m))
+	for dev := range m {
+		devices = append(devices, dev)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Major != devices[j].Major {
+			return devices[i].Major < devices[j].Major
+		}
+		return devices[i].Minor < devices[j].Minor
+	})
+	return devices
+}
@@ -0,0 +1,109 @@
+package cgroup
+
+import (
+	"fmt"
+	"strconv"
+
+	cgroupv2 "github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+// CPUSubSystem defines the settings of the v1 cpu controller.
+// A nil field leaves the corresponding file at its kernel default.
+type CPUSubSystem struct {
+	// cpu.shares: relative CPU time distribution (2 ~ 262144)
+	Shares *uint64
+	// cpu.cfs_quota_us: CPU time per period; -1 means unlimited.
+	Quota *int64
+	// cpu.cfs_period_us
+	Period *uint64
+	// cpu.rt_runtime_us: realtime CPU time per realtime period
+	RealtimeRuntime *int64
+	// cpu.rt_period_us
+	RealtimePeriod *uint64
+}
+
+func (c *CPUSubSystem) Name() string {
+	return "cpu"
+}
+
+// Apply applies the CPU shares and bandwidth limits. Periods are written
+// before the runtimes they bound.
+func (c *CPUSubSystem) Apply(path string) error {
+	var files []cgroupv2.CgroupFile
+	if c.Shares != nil {
+		files = append(files, cgroupv2.CgroupFile{Filename: "cpu.shares", Value: strconv.FormatUint(*c.Shares, 10)})
+	}
+	if c.Period != nil {
+		files = append(files, cgroupv2.CgroupFile{Filename: "cpu.cfs_period_us", Value: strconv.FormatUint(*c.Period, 10)})
+	}
+	if c.Quota != nil {
+		files = append(files, cgroupv2.CgroupFile{Filename: "cpu.cfs_quota_us", Value: strconv.FormatInt(*c.Quota, 10)})
+	}
+	if c.RealtimePeriod != nil {
+		files = append(files, cgroupv2.CgroupFile{Filename: "cpu.rt_period_us", Value: strconv.FormatUint(*c.RealtimePeriod, 10)})
+	}
+	if c.RealtimeRuntime != nil {
+		files = append(files, cgroupv2.CgroupFile{Filename: "cpu.rt_runtime_us", Value: strconv.FormatInt(*c.RealtimeRuntime, 10)})
+	}
+
+	for _, f := range files {
+		if err := writeFile(path, f.Filename, f.Value); err != nil {
+			return fmt.Errorf("cpu subsystem: failed to set %s: %w", f.Filename, err)
+		}
+	}
+	return nil
+}
+
+// Stat reads the throttling counters from cpu.stat.
+func (c *CPUSubSystem) Stat(path string, stats *cgroupv2.Stats) error {
+	values, err := readKeyValues(path, "cpu.stat")
+	if err != nil {
+		return fmt.Errorf("cpu subsystem: %w", err)
+	}
+	if stats.CPU == nil {
+		stats.CPU = &cgroupv2.CPUStats{}
+	}
+	stats.CPU.NrPeriods = values["nr_periods"]
+	stats.CPU.NrThrottled = values["nr_throttled"]
+	stats.CPU.ThrottledUsec = values["throttled_time"] / 1000
+	return nil
+}
+
+// CPUAcctSubSystem reports CPU usage through the v1 cpuacct controller. It
+// has no settings.
+type CPUAcctSubSystem struct{}
+
+func (c *CPUAcctSubSystem) Name() string {
+	return "cpuacct"
+}
+
+// Apply does nothing, as cpuacct only accounts.
+func (c *CPUAcctSubSystem) Apply(string) error {
+	return nil
+}
+
+// Stat reads the CPU usage, which cpuacct reports in nanoseconds.
+func (c *CPUAcctSubSystem) Stat(path string, stats *cgroupv2.Stats) error {
+	var usage, user, system uint64
+	counters := []struct {
+		filename string
+		value    *uint64
+	}{
+		{"cpuacct.usage", &usage},
+		{"cpuacct.usage_user", &user},
+		{"cpuacct.usage_sys", &system},
+	}
+	for _, counter := range counters {
+		if err := readUint(path, counter.filename, counter.value); err != nil {
+			return fmt.Errorf("cpuacct subsystem: %w", err)
+		}
+	}
+
+	if stats.CPU == nil {
+		stats.CPU = &cgroupv2.CPUStats{}
+	}
+	stats.CPU.UsageUsec = usage / 1000
+	stats.CPU.UserUsec = user / 1000
+	stats.CPU.SystemUsec = system / 1000
+	return nil
+}
@@ -0,0 +1,92 @@
+package cgroup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	cgroupv2 "github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+// CpusetSubSystem defines the CPUs and memory nodes a cgroup may use. Empty
+// fields inherit the parent's setting.
+type CpusetSubSystem struct {
+	// cpuset.cpus: CPU list such as "0-3,8"
+	Cpus string
+	// cpuset.mems: memory node list such as "0-1"
+	Mems string
+}
+
+func (c *CpusetSubSystem) Name() string {
+	return "cpuset"
+}
+
+// Apply applies the CPU and memory node lists. A v1 cpuset cgroup only accepts
+// tasks once both are set, and new cgroups start with both empty, so unset
+// lists, including those of freshly created ancestors, are copied down from
+// the parent.
+func (c *CpusetSubSystem) Apply(path string) error {
+	var ancestors []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "cpuset.cpus")); err != nil {
+			break
+		}
+		ancestors = append(ancestors, dir)
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	// The top of the hierarchy always has both lists set.
+	for i := len(ancestors) - 2; i >= 0; i-- {
+		if err := inheritCpuset(ancestors[i], "", ""); err != nil {
+			return err
+		}
+	}
+	return inheritCpuset(path, c.Cpus, c.Mems)
+}
+
+// inheritCpuset writes cpus and mems to the cgroup at path, copying empty
+// values, and the lists the cgroup does not have yet, from its parent.
+func inheritCpuset(path, cpus, mems string) error {
+	parent := filepath.Dir(path)
+	for _, file := range []struct {
+		filename string
+		value    string
+	}{
+		{"cpuset.cpus", cpus},
+		{"cpuset.mems", mems},
+	} {
+		value := file.value
+		if value == "" {
+			current, err := readFile(path, file.filename)
+			if err != nil {
+				return fmt.Errorf("cpuset subsystem: failed to read %s: %w", file.filename, err)
+			}
+			if current != "" {
+				continue
+			}
+			value, err = readFile(parent, file.filename)
+			if err != nil {
+				return fmt.Errorf("cpuset subsystem: failed to read parent %s: %w", file.filename, err)
+			}
+		}
+		if err := writeFile(path, file.filename, value); err != nil {
+			return fmt.Errorf("cpuset subsystem: failed to set %s in %s: %w", file.filename, path, err)
+		}
+	}
+	return nil
+}
+
+// Stat reads the effective CPU and memory node lists.
+func (c *CpusetSubSystem) Stat(path string, stats *cgroupv2.Stats) error {
+	cpusetStats := &cgroupv2.CpusetStats{}
+	var err error
+	if cpusetStats.CpusEffective, err = readFile(path, "cpuset.effective_cpus"); err != nil {
+		return fmt.Errorf("cpuset subsystem: failed to read cpuset.effective_cpus: %w", err)
+	}
+	if cpusetStats.MemsEffective, err = readFile(path, "cpuset.effective_mems"); err != nil {
+		return fmt.Errorf("cpuset subsystem: failed to read cpuset.effective_mems: %w", err)
+	}
+	stats.Cpuset = cpusetStats
+	return nil
+}
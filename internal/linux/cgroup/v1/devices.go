@@ -0,0 +1,69 @@
+package cgroup
+
+import (
+	"fmt"
+
+	cgroupv2 "github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+// DeviceRule allows or denies access to devices.
+type DeviceRule struct {
+	Allow bool
+	// Type is "a" (all), "b" (block) or "c" (character).
+	Type string
+	// Major and Minor select the device; nil matches every number.
+	Major *int64
+	Minor *int64
+	// Access is a combination of "r" (read), "w" (write) and "m" (mknod).
+	Access string
+}
+
+// String returns the rule in the form written to devices.allow and
+// devices.deny, such as "c 1:3 rwm".
+func (r DeviceRule) String() string {
+	deviceType := r.Type
+	if deviceType == "" {
+		deviceType = "a"
+	}
+	major, minor := "*", "*"
+	if r.Major != nil {
+		major = fmt.Sprint(*r.Major)
+	}
+	if r.Minor != nil {
+		minor = fmt.Sprint(*r.Minor)
+	}
+	access := r.Access
+	if access == "" {
+		access = "rwm"
+	}
+	return fmt.Sprintf("%s %s:%s %s", deviceType, major, minor, access)
+}
+
+// DevicesSubSystem controls device access through the v1 devices controller.
+type DevicesSubSystem struct {
+	// Rules are applied in order, so later rules override earlier ones.
+	Rules []DeviceRule
+}
+
+func (d *DevicesSubSystem) Name() string {
+	return "devices"
+}
+
+// Apply writes every rule to devices.allow or devices.deny.
+func (d *DevicesSubSystem) Apply(path string) error {
+	for _, rule := range d.Rules {
+		filename := "devices.deny"
+		if rule.Allow {
+			filename = "devices.allow"
+		}
+		if err := writeFile(path, filename, rule.String()); err != nil {
+			return fmt.Errorf("devices subsystem: failed to write %q to %s: %w", rule, filename, err)
+		}
+	}
+	return nil
+}
+
+// Stat does nothing, as the devices controller has no statistics.
+func (d *DevicesSubSystem) Stat(string, *cgroupv2.Stats) error {
+	return nil
+}
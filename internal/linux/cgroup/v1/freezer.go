@@ -0,0 +1,148 @@
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// killTimeout bounds how long Kill waits for the cgroup to empty.
+	killTimeout = 10 * time.Second
+	// freezeTimeout bounds how long Kill waits for the cgroup to freeze.
+	freezeTimeout = 5 * time.Second
+	// pollInterval is how often freezer and process state is re-read. Unlike
+	// cgroup v2, cgroup v1 has no files that signal these changes.
+	pollInterval = 10 * time.Millisecond
+)
+
+// Kill freezes the container cgroup so that no process can fork, kills every
+// process in it, and waits until it is empty. Without the freezer hierarchy,
+// it kills the processes without freezing them first.
+func (m *Manager) Kill() error {
+	dir := m.Path()
+	if dir == "" {
+		return nil
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if freezerDir, ok := m.dir("freezer"); !ok || freezerDir != dir {
+		return killUnfrozen(dir)
+	}
+
+	if err := writeFile(dir, "freezer.state", "FROZEN"); err != nil {
+		return fmt.Errorf("cgroup: failed to freeze cgroup: %w", err)
+	}
+	frozenErr := waitFor(freezeTimeout, func() (bool, error) {
+		state, err := readFile(dir, "freezer.state")
+		return state == "FROZEN", err
+	})
+
+	var killErr error
+	if frozenErr == nil {
+		killErr = signalProcs(dir, syscall.SIGKILL)
+	}
+	// Thawing lets the killed processes run their exit path.
+	if err := writeFile(dir, "freezer.state", "THAWED"); err != nil {
+		return fmt.Errorf("cgroup: failed to thaw cgroup: %w", err)
+	}
+	if frozenErr != nil {
+		return fmt.Errorf("cgroup: cgroup did not freeze: %w", frozenErr)
+	}
+	if killErr != nil {
+		return killErr
+	}
+
+	err := waitFor(killTimeout, func() (bool, error) {
+		pids, err := procs(dir)
+		return len(pids) == 0, err
+	})
+	if err != nil {
+		return fmt.Errorf("cgroup: processes did not exit: %w", err)
+	}
+	return nil
+}
+
+// killUnfrozen kills the processes in the cgroup at dir until it is empty.
+// Without a freezer, a process can fork while the others are being killed, so
+// the cgroup is re-read and its processes killed again until none are left.
+func killUnfrozen(dir string) error {
+	err := waitFor(killTimeout, func() (bool, error) {
+		pids, err := procs(dir)
+		if err != nil || len(pids) == 0 {
+			return err == nil, err
+		}
+		return false, signalProcs(dir, syscall.SIGKILL)
+	})
+	if err != nil {
+		return fmt.Errorf("cgroup: processes did not exit: %w", err)
+	}
+	return nil
+}
+
+// signalProcs sends sig to every process in the cgroup at path and its descendants.
+func signalProcs(path string, sig syscall.Signal) error {
+	pids, err := procs(path)
+	if err != nil {
+		return err
+	}
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, sig); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("cgroup: failed to kill process %d: %w", pid, err)
+		}
+	}
+	return nil
+}
+
+// procs returns the processes in the cgroup at path and its descendants.
+func procs(path string) ([]int, error) {
+	var pids []int
+	err := filepath.WalkDir(path, func(dir string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		content, err := readFile(dir, "cgroup.procs")
+		if err != nil {
+			return err
+		}
+		for _, field := range strings.Fields(content) {
+			pid, err := strconv.Atoi(field)
+			if err != nil {
+				return fmt.Errorf("invalid pid %q in %s/cgroup.procs", field, dir)
+			}
+			pids = append(pids, pid)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cgroup: failed to list processes: %w", err)
+	}
+	return pids, nil
+}
+
+// waitFor polls done until it reports true or timeout passes.
+func waitFor(timeout time.Duration, done func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := done()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
@@ -0,0 +1,43 @@
+package cgroup
+
+import (
+	"fmt"
+	"strconv"
+
+	cgroupv2 "github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+// HugetlbSubSystem defines the huge page limits of the v1 hugetlb controller.
+type HugetlbSubSystem struct {
+	Limits map[string]uint64 // map of hugepage size, such as "2MB", to limit in bytes
+}
+
+func (h *HugetlbSubSystem) Name() string {
+	return "hugetlb"
+}
+
+// Apply applies hugetlb subsystem limits.
+func (h *HugetlbSubSystem) Apply(path string) error {
+	for pageSize, limit := range h.Limits {
+		filename := "hugetlb." + pageSize + ".limit_in_bytes"
+		if err := writeFile(path, filename, strconv.FormatUint(limit, 10)); err != nil {
+			return fmt.Errorf("hugetlb subsystem: failed to set %s: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+// Stat reads the usage of every configured page size.
+func (h *HugetlbSubSystem) Stat(path string, stats *cgroupv2.Stats) error {
+	if stats.Hugetlb == nil {
+		stats.Hugetlb = make(map[string]cgroupv2.HugetlbStats)
+	}
+	for pageSize := range h.Limits {
+		var pageStats cgroupv2.HugetlbStats
+		if err := readUint(path, "hugetlb."+pageSize+".usage_in_bytes", &pageStats.Current); err != nil {
+			return fmt.Errorf("hugetlb subsystem: %w", err)
+		}
+		stats.Hugetlb[pageSize] = pageStats
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package cgroup
+
+import (
+	"fmt"
+	"strconv"
+
+	cgroupv2 "github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+// MemorySubSystem defines the memory limits of the v1 memory controller.
+// A nil field leaves the corresponding file at its kernel default; -1 means unlimited.
+type MemorySubSystem struct {
+	// memory.limit_in_bytes
+	Limit *int64
+	// memory.soft_limit_in_bytes
+	Reservation *int64
+	// memory.memsw.limit_in_bytes: the limit of memory and swap combined
+	Swap *int64
+	// memory.swappiness (0 ~ 100)
+	Swappiness *uint64
+	// memory.oom_control: pauses tasks at the limit instead of OOM-killing them
+	DisableOOMKiller *bool
+}
+
+func (m *MemorySubSystem) Name() string {
+	return "memory"
+}
+
+// Apply applies memory subsystem limits. The kernel rejects a memory limit
+// above the combined memory and swap limit, so when the memory limit grows
+// the combined limit is raised first.
+func (m *MemorySubSystem) Apply(path string) error {
+	var files []cgroupv2.CgroupFile
+	switch {
+	case m.Limit != nil && m.Swap != nil:
+		current, err := readFile(path, "memory.limit_in_bytes")
+		if err != nil {
+			return fmt.Errorf("memory subsystem: failed to read memory.limit_in_bytes: %w", err)
+		}
+		currentLimit, err := strconv.ParseInt(current, 10, 64)
+		if err != nil {
+			return fmt.Errorf("memory subsystem: failed to parse memory.limit_in_bytes: %w", err)
+		}
+		limit := cgroupv2.CgroupFile{Filename: "memory.limit_in_bytes", Value: strconv.FormatInt(*m.Limit, 10)}
+		swap := cgroupv2.CgroupFile{Filename: "memory.memsw.limit_in_bytes", Value: strconv.FormatInt(*m.Swap, 10)}
+		if *m.Limit == -1 || *m.Limit > currentLimit {
+			files = append(files, swap, limit)
+		} else {
+			files = append(files, limit, swap)
+		}
+	case m.Limit != nil:
+		files = append(files, cgroupv2.CgroupFile{Filename: "memory.limit_in_bytes", Value: strconv.FormatInt(*m.Limit, 10)})
+	case m.Swap != nil:
+		files = append(files, cgroupv2.CgroupFile{Filename: "memory.memsw.limit_in_bytes", Value: strconv.FormatInt(*m.Swap, 10)})
+	}
+
+	if m.Reservation != nil {
+		files = append(files, cgroupv2.CgroupFile{Filename: "memory.soft_limit_in_bytes", Value: strconv.FormatInt(*m.Reservation, 10)})
+	}
+	if m.Swappiness != nil {
+		files = append(files, cgroupv2.CgroupFile{Filename: "memory.swappiness", Value: strconv.FormatUint(*m.Swappiness, 10)})
+	}
+	if m.DisableOOMKiller != nil && *m.DisableOOMKiller {
+		files = append(files, cgroupv2.CgroupFile{Filename: "memory.oom_control", Value: "1"})
+	}
+
+	for _, f := range files {
+		if err := writeFile(path, f.Filename, f.Value); err != nil {
+			return fmt.Errorf("memory subsystem: failed to set %s: %w", f.Filename, err)
+		}
+	}
+	return nil
+}
+
+// Stat reads memory usage, peaks, limit hits and the memory.stat breakdown.
+func (m *MemorySubSystem) Stat(path string, stats *cgroupv2.Stats) error {
+	memStats := &cgroupv2.MemoryStats{}
+	var memswUsage, memswPeak uint64
+	counters := []struct {
+		filename string
+		value    *uint64
+	}{
+		{"memory.usage_in_bytes", &memStats.Current},
+		{"memory.max_usage_in_bytes", &memStats.Peak},
+		{"memory.memsw.usage_in_bytes", &memswUsage},
+		{"memory.memsw.max_usage_in_bytes", &memswPeak},
+		{"memory.failcnt", &memStats.Events.Max},
+	}
+	for _, c := range counters {
+		if err := readUint(path, c.filename, c.value); err != nil {
+			return fmt.Errorf("memory subsystem: %w", err)
+		}
+	}
+	// The memsw counters include memory, while cgroup v2 reports swap alone.
+	if memswUsage > memStats.Current {
+		memStats.SwapCurrent = memswUsage - memStats.Current
+	}
+	if memswPeak > memStats.Peak {
+		memStats.SwapPeak = memswPeak - memStats.Peak
+	}
+
+	oomControl, err := readKeyValues(path, "memory.oom_control")
+	if err != nil {
+		return fmt.Errorf("memory subsystem: %w", err)
+	}
+	memStats.Events.OOMKill = oomControl["oom_kill"]
+
+	memStats.Stat, err = readKeyValues(path, "memory.stat")
+	if err != nil {
+		return fmt.Errorf("memory subsystem: %w", err)
+	}
+
+	stats.Memory = memStats
+	return nil
+}
@@ -0,0 +1,49 @@
+package cgroup
+
+import (
+	"fmt"
+	"strconv"
+
+	cgroupv2 "github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+// PidsSubSystem defines the process number limit. A nil limit leaves pids.max
+// at its kernel default; -1 means "max".
+type PidsSubSystem struct {
+	Limit *int64
+}
+
+func (p *PidsSubSystem) Name() string {
+	return "pids"
+}
+
+// Apply applies the pids limit.
+func (p *PidsSubSystem) Apply(path string) error {
+	if p.Limit == nil {
+		return nil
+	}
+	value := "max"
+	if *p.Limit >= 0 {
+		value = strconv.FormatInt(*p.Limit, 10)
+	}
+	if err := writeFile(path, "pids.max", value); err != nil {
+		return fmt.Errorf("pids subsystem: failed to set pids.max: %w", err)
+	}
+	return nil
+}
+
+// Stat reads the current process count and the pids.max events.
+func (p *PidsSubSystem) Stat(path string, stats *cgroupv2.Stats) error {
+	pidsStats := &cgroupv2.PidsStats{}
+	if err := readUint(path, "pids.current", &pidsStats.Current); err != nil {
+		return fmt.Errorf("pids subsystem: %w", err)
+	}
+	events, err := readKeyValues(path, "pids.events")
+	if err != nil {
+		return fmt.Errorf("pids subsystem: %w", err)
+	}
+	pidsStats.MaxEvents = events["max"]
+
+	stats.Pids = pidsStats
+	return nil
+}
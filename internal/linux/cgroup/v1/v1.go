@@ -0,0 +1,331 @@
+package cgroup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	cgroupv2 "github.com/yoonhyunwoo/containeruntime/internal/linux/cgroup/v2"
+)
+
+// implementedSubsystems holds a value of every subsystem the runtime implements.
+var implementedSubsystems = []SubSystem{
+	&MemorySubSystem{},
+	&CPUSubSystem{},
+	&CPUAcctSubSystem{},
+	&PidsSubSystem{},
+	&CpusetSubSystem{},
+	&BlkioSubSystem{},
+	&DevicesSubSystem{},
+	&HugetlbSubSystem{},
+}
+
+// Controllers returns the cgroup v1 controllers the runtime uses: those it has
+// subsystems for, and the freezer, which the Manager uses itself.
+func Controllers() []string {
+	controllers := make([]string, 0, len(implementedSubsystems)+1)
+	for _, s := range implementedSubsystems {
+		controllers = append(controllers, s.Name())
+	}
+	return append(controllers, "freezer")
+}
+
+// SubSystem represents a cgroup v1 controller. It has the same semantics as
+// its cgroup v2 counterpart, applied to the controller's own hierarchy.
+type SubSystem interface {
+	// Name returns the controller, which also identifies its hierarchy.
+	Name() string
+	// Apply writes the configured knobs to the cgroup at path. Knobs that are
+	// not set are left at their current value, and read-only files are never written.
+	Apply(path string) error
+	// Stat reads the controller's statistics from the cgroup at path into stats.
+	Stat(path string, stats *cgroupv2.Stats) error
+}
+
+// Manager manages the cgroups of a container on a host with cgroup v1, where
+// each controller has its own hierarchy. It implements cgroupv2.Manager, so
+// the runtime can use either transparently.
+type Manager struct {
+	// mounts maps each controller to the mount point of its hierarchy.
+	mounts map[string]string
+	path   string
+	// anchor is the controller whose hierarchy Path returns the cgroup in,
+	// once it is known from a recorded path.
+	anchor     string
+	subsystems []SubSystem
+	unified    map[string]string
+	bestEffort bool
+}
+
+var _ cgroupv2.Manager = (*Manager)(nil)
+
+// NewManager creates a new Manager for the cgroup at path, relative to the
+// root of every hierarchy.
+func NewManager(path string, subsystems []SubSystem) (*Manager, error) {
+	mounts, err := readMounts("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{mounts: mounts, path: path, subsystems: subsystems}, nil
+}
+
+// LoadManager creates a Manager for an existing container from the path
+// returned by Manager.Path.
+func LoadManager(path string) (*Manager, error) {
+	mounts, err := readMounts("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	return loadManager(mounts, path)
+}
+
+// loadManager creates a Manager for the container cgroup at path in one of
+// the hierarchies mounted at mounts.
+func loadManager(mounts map[string]string, path string) (*Manager, error) {
+	// Path records the cgroup in one hierarchy; the longest mount point that
+	// contains it is that hierarchy's.
+	var anchor, relPath string
+	for _, controller := range Controllers() {
+		mount, ok := mounts[controller]
+		if !ok {
+			continue
+		}
+		rel, err := filepath.Rel(mount, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if anchor == "" || len(mount) > len(mounts[anchor]) {
+			anchor, relPath = controller, rel
+		}
+	}
+	if anchor == "" {
+		return nil, fmt.Errorf("cgroup: %s is not a cgroup in any cgroup v1 hierarchy", path)
+	}
+	return &Manager{mounts: mounts, path: "/" + relPath, anchor: anchor}, nil
+}
+
+// readMounts maps every controller to the mount point of its hierarchy, as
+// listed in a mountinfo file. Co-mounted controllers, such as cpu and cpuacct,
+// share a mount point.
+func readMounts(mountinfoPath string) (map[string]string, error) {
+	f, err := os.Open(mountinfoPath)
+	if err != nil {
+		return nil, fmt.Errorf("cgroup: failed to read mounts: %w", err)
+	}
+	defer f.Close()
+
+	controllers := Controllers()
+	mounts := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 25 0:31 / /sys/fs/cgroup/memory rw,nosuid - cgroup cgroup rw,memory
+		fields := strings.Fields(scanner.Text())
+		separator := slices.Index(fields, "-")
+		if separator < 5 || len(fields) < separator+4 || fields[separator+1] != "cgroup" {
+			continue
+		}
+		for _, option := range strings.Split(fields[separator+3], ",") {
+			if slices.Contains(controllers, option) {
+				if _, ok := mounts[option]; !ok {
+					mounts[option] = fields[4]
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cgroup: failed to read mounts: %w", err)
+	}
+	return mounts, nil
+}
+
+// dir returns the container cgroup in the hierarchy of controller.
+func (m *Manager) dir(controller string) (string, bool) {
+	mount, ok := m.mounts[controller]
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(mount, m.path), true
+}
+
+// controllers returns the controllers whose hierarchy the container joins:
+// those of its subsystems, and the freezer, which Kill relies on.
+func (m *Manager) controllers() []string {
+	var controllers []string
+	for _, s := range m.subsystems {
+		if !slices.Contains(controllers, s.Name()) {
+			controllers = append(controllers, s.Name())
+		}
+	}
+	if _, ok := m.mounts["freezer"]; ok && !slices.Contains(controllers, "freezer") {
+		controllers = append(controllers, "freezer")
+	}
+	return controllers
+}
+
+// SetUnified records linux.resources.unified values, which cgroup v1 cannot
+// apply: Setup fails if there are any.
+func (m *Manager) SetUnified(values map[string]string) {
+	m.unified = values
+}
+
+// SetBestEffort makes Setup skip, with a warning, the subsystems whose
+// hierarchy is not mounted instead of failing.
+func (m *Manager) SetBestEffort(bestEffort bool) {
+	m.bestEffort = bestEffort
+}
+
+// Setup creates the container cgroup in the hierarchy of every subsystem and
+// configures it.
+func (m *Manager) Setup() error {
+	if len(m.unified) > 0 {
+		return errors.New("cgroup: linux.resources.unified requires cgroup v2, but the host uses cgroup v1")
+	}
+
+	var available []SubSystem
+	for _, s := range m.subsystems {
+		if _, ok := m.mounts[s.Name()]; !ok {
+			err := fmt.Errorf("cgroup: the %s controller is not mounted; mount its cgroup v1 hierarchy, or use best-effort mode to skip its limits", s.Name())
+			if !m.bestEffort {
+				return err
+			}
+			log.Printf("cgroup: warning: skipping %s limits: %v", s.Name(), err)
+			continue
+		}
+		available = append(available, s)
+	}
+	m.subsystems = available
+
+	for _, controller := range m.controllers() {
+		dir, _ := m.dir(controller)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("cgroup: failed to create cgroup %s: %w", dir, err)
+		}
+	}
+
+	for _, s := range m.subsystems {
+		dir, _ := m.dir(s.Name())
+		if err := s.Apply(dir); err != nil {
+			return fmt.Errorf("cgroup: subsystem %s apply failed: %w", s.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Path returns the container cgroup in the freezer hierarchy, which Kill
+// relies on, or, if the freezer is not mounted, in the first mounted hierarchy
+// the container joins. It returns "" if the container joins none.
+func (m *Manager) Path() string {
+	if m.anchor != "" {
+		dir, _ := m.dir(m.anchor)
+		return dir
+	}
+	if dir, ok := m.dir("freezer"); ok {
+		return dir
+	}
+	for _, controller := range m.controllers() {
+		if dir, ok := m.dir(controller); ok {
+			return dir
+		}
+	}
+	return ""
+}
+
+// AddProcess moves a process into the container cgroup of every hierarchy.
+func (m *Manager) AddProcess(pid int) error {
+	for _, controller := range m.controllers() {
+		dir, _ := m.dir(controller)
+		if err := writeFile(dir, "cgroup.procs", strconv.Itoa(pid)); err != nil {
+			return fmt.Errorf("cgroup: failed to add process %d to %s cgroup: %w", pid, controller, err)
+		}
+	}
+	return nil
+}
+
+// Stats reads the statistics of every configured subsystem.
+func (m *Manager) Stats() (*cgroupv2.Stats, error) {
+	stats := &cgroupv2.Stats{}
+	for _, s := range m.subsystems {
+		dir, _ := m.dir(s.Name())
+		if err := s.Stat(dir, stats); err != nil {
+			return nil, fmt.Errorf("cgroup: subsystem %s stat failed: %w", s.Name(), err)
+		}
+	}
+	return stats, nil
+}
+
+// Clean removes the container cgroup, and any cgroups below it, from every
+// hierarchy.
+func (m *Manager) Clean() error {
+	if filepath.Clean(m.path) == "/" {
+		return errors.New("cgroup: refusing to remove the root cgroup")
+	}
+	for _, mount := range m.mounts {
+		if err := cgroupv2.RemoveTree(filepath.Join(mount, m.path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile writes a value to a cgroup file.
+func writeFile(path, filename, value string) error {
+	return os.WriteFile(filepath.Join(path, filename), []byte(value), 0o600)
+}
+
+// readFile reads a cgroup file with surrounding whitespace removed.
+func readFile(path, filename string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(path, filename))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// readUint reads a single-value cgroup file into dst. A missing file, as on
+// kernels without that interface, leaves dst unchanged.
+func readUint(path, filename string, dst *uint64) error {
+	content, err := readFile(path, filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	value, err := strconv.ParseUint(content, 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	*dst = value
+	return nil
+}
+
+// readKeyValues reads a flat keyed file such as memory.stat. A missing file
+// yields an empty map.
+func readKeyValues(path, filename string) (map[string]uint64, error) {
+	values := make(map[string]uint64)
+	content, err := readFile(path, filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+		}
+		values[fields[0]] = value
+	}
+	return values, nil
+}
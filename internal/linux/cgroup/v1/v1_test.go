@@ -0,0 +1,183 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFileT(t *testing.T, dir, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestReadMounts(t *testing.T) {
+	mountinfo := filepath.Join(t.TempDir(), "mountinfo")
+	writeFiles(t, filepath.Dir(mountinfo), map[string]string{"mountinfo": strings.Join([]string{
+		"25 30 0:23 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw",
+		"31 25 0:26 / /sys/fs/cgroup ro,nosuid,nodev,noexec shared:9 - tmpfs tmpfs ro,mode=755",
+		"32 31 0:27 / /sys/fs/cgroup/unified rw,nosuid,nodev,noexec,relatime shared:10 - cgroup2 cgroup2 rw",
+		"33 31 0:28 / /sys/fs/cgroup/systemd rw,nosuid,nodev,noexec,relatime shared:11 - cgroup cgroup rw,xattr,name=systemd",
+		"36 31 0:31 / /sys/fs/cgroup/cpu,cpuacct rw,nosuid,nodev,noexec,relatime shared:15 - cgroup cgroup rw,cpu,cpuacct",
+		"37 31 0:32 / /sys/fs/cgroup/memory rw,nosuid,nodev,noexec,relatime shared:16 - cgroup cgroup rw,memory",
+		"38 31 0:33 / /sys/fs/cgroup/freezer rw,nosuid,nodev,noexec,relatime shared:17 - cgroup cgroup rw,freezer",
+	}, "\n")})
+
+	got, err := readMounts(mountinfo)
+	if err != nil {
+		t.Fatalf("readMounts failed: %v", err)
+	}
+	want := map[string]string{
+		"cpu":     "/sys/fs/cgroup/cpu,cpuacct",
+		"cpuacct": "/sys/fs/cgroup/cpu,cpuacct",
+		"memory":  "/sys/fs/cgroup/memory",
+		"freezer": "/sys/fs/cgroup/freezer",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readMounts = %v, want %v", got, want)
+	}
+}
+
+func TestManagerSetup(t *testing.T) {
+	root := t.TempDir()
+	mounts := map[string]string{
+		"memory":  filepath.Join(root, "memory"),
+		"cpuset":  filepath.Join(root, "cpuset"),
+		"freezer": filepath.Join(root, "freezer"),
+	}
+	writeFiles(t, mounts["memory"], nil)
+	writeFiles(t, mounts["freezer"], nil)
+	writeFiles(t, mounts["cpuset"], map[string]string{"cpuset.cpus": "0-7\n", "cpuset.mems": "0\n"})
+	// New cpuset cgroups start with empty lists.
+	writeFiles(t, filepath.Join(mounts["cpuset"], "tenant"), map[string]string{"cpuset.cpus": "\n", "cpuset.mems": "\n"})
+	writeFiles(t, filepath.Join(mounts["cpuset"], "tenant", "abc"), map[string]string{"cpuset.cpus": "\n", "cpuset.mems": "\n"})
+	writeFiles(t, filepath.Join(mounts["memory"], "tenant", "abc"), map[string]string{"memory.limit_in_bytes": "9223372036854771712\n"})
+
+	limit, swap := int64(256<<20), int64(512<<20)
+	pidsLimit := int64(10)
+	m := &Manager{
+		mounts: mounts,
+		path:   "/tenant/abc",
+		subsystems: []SubSystem{
+			&MemorySubSystem{Limit: &limit, Swap: &swap},
+			&CpusetSubSystem{Cpus: "2-3"},
+			&PidsSubSystem{Limit: &pidsLimit},
+		},
+	}
+
+	if err := m.Setup(); err == nil || !strings.Contains(err.Error(), "pids controller is not mounted") {
+		t.Fatalf("Setup error = %v, want the pids controller to be missing", err)
+	}
+	m.SetBestEffort(true)
+	if err := m.Setup(); err != nil {
+		t.Fatalf("best-effort Setup failed: %v", err)
+	}
+
+	memoryDir := filepath.Join(mounts["memory"], "tenant", "abc")
+	if got := readFileT(t, memoryDir, "memory.limit_in_bytes"); got != "268435456" {
+		t.Errorf("memory.limit_in_bytes = %q", got)
+	}
+	if got := readFileT(t, memoryDir, "memory.memsw.limit_in_bytes"); got != "536870912" {
+		t.Errorf("memory.memsw.limit_in_bytes = %q", got)
+	}
+
+	tenantDir := filepath.Join(mounts["cpuset"], "tenant")
+	if got := readFileT(t, tenantDir, "cpuset.cpus"); got != "0-7" {
+		t.Errorf("intermediate cpuset.cpus = %q, want it copied from the parent", got)
+	}
+	cpusetDir := filepath.Join(tenantDir, "abc")
+	if got := readFileT(t, cpusetDir, "cpuset.cpus"); got != "2-3" {
+		t.Errorf("cpuset.cpus = %q, want \"2-3\"", got)
+	}
+	if got := readFileT(t, cpusetDir, "cpuset.mems"); got != "0" {
+		t.Errorf("cpuset.mems = %q, want it copied from the parent", got)
+	}
+
+	if _, err := os.Stat(filepath.Join(mounts["freezer"], "tenant", "abc")); err != nil {
+		t.Errorf("container was not placed in the freezer hierarchy: %v", err)
+	}
+	if got, want := m.Path(), filepath.Join(mounts["freezer"], "tenant", "abc"); got != want {
+		t.Errorf("Path() = %q, want %q", got, want)
+	}
+}
+
+func TestDeviceRuleString(t *testing.T) {
+	major, minor := int64(1), int64(3)
+	tests := []struct {
+		rule DeviceRule
+		want string
+	}{
+		{DeviceRule{Access: "rwm"}, "a *:* rwm"},
+		{DeviceRule{Allow: true, Type: "c", Major: &major, Minor: &minor, Access: "rw"}, "c 1:3 rw"},
+		{DeviceRule{Type: "b", Major: &major}, "b 1:* rwm"},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestManagerWithoutFreezer(t *testing.T) {
+	root := t.TempDir()
+	mounts := map[string]string{
+		"cpu":     filepath.Join(root, "cpu,cpuacct"),
+		"cpuacct": filepath.Join(root, "cpu,cpuacct"),
+		"memory":  filepath.Join(root, "memory"),
+	}
+	m := &Manager{
+		mounts:     mounts,
+		path:       "/tenant/abc",
+		subsystems: []SubSystem{&PidsSubSystem{}, &MemorySubSystem{}, &CPUSubSystem{}},
+	}
+	want := filepath.Join(mounts["memory"], "tenant", "abc")
+	if got := m.Path(); got != want {
+		t.Errorf("Path() = %q, want the first mounted hierarchy %q", got, want)
+	}
+	if got := (&Manager{mounts: mounts, path: "/abc"}).Path(); got != "" {
+		t.Errorf("Path() of a manager without subsystems = %q, want \"\"", got)
+	}
+
+	loaded, err := loadManager(mounts, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.path != "/tenant/abc" || loaded.Path() != want {
+		t.Errorf("loaded manager has path %q and Path() %q, want /tenant/abc and %q", loaded.path, loaded.Path(), want)
+	}
+	for _, path := range []string{mounts["memory"], filepath.Join(root, "freezer", "abc")} {
+		if _, err := loadManager(mounts, path); err == nil {
+			t.Errorf("loadManager(%q) succeeded, want error", path)
+		}
+	}
+
+	// Kill does nothing for a cgroup that was never created, and returns as
+	// soon as an existing one is empty.
+	if err := m.Kill(); err != nil {
+		t.Errorf("Kill() of a missing cgroup = %v", err)
+	}
+	writeFiles(t, want, map[string]string{"cgroup.procs": ""})
+	for _, m := range []*Manager{m, loaded} {
+		if err := m.Kill(); err != nil {
+			t.Errorf("Kill() of an empty cgroup = %v", err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// unixWOK is W_OK from unistd.h, which the syscall package does not define.
+const unixWOK = 0x2
+
+// ControllerUnavailableError reports that a controller cannot be enabled for a
+// cgroup because no ancestor has it available.
+type ControllerUnavailableError struct {
+	Controller string
+	Path       string
+}
+
+func (e *ControllerUnavailableError) Error() string {
+	return fmt.Sprintf("cgroup: the %s controller is not available for %s; "+
+		"enable it in the cgroup.subtree_control of a parent cgroup (or delegate it to the runtime), "+
+		"or use best-effort mode to skip its limits", e.Controller, e.Path)
+}
+
+// readControllers reads the controllers listed in a cgroup's cgroup.controllers.
+func readControllers(fs FileSystem, dir string) ([]string, error) {
+	content, err := readCgroupFile(fs, dir, "cgroup.controllers")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read available controllers of %s: %w", dir, err)
+	}
+	return strings.Fields(content), nil
+}
+
+// cgroupAncestors returns the ancestors of path that belong to the cgroup
+// hierarchy and that the runtime may manage, nearest first. Levels that do not
+// exist yet are skipped. The walk stops below the first cgroup whose
+// cgroup.subtree_control is not writable, such as the parent of a cgroup
+// delegated to an unprivileged user.
+func cgroupAncestors(fs FileSystem, path string) []string {
+	var ancestors []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if _, err := fs.Stat(filepath.Join(dir, "cgroup.controllers")); err == nil {
+			if !subtreeControlWritable(dir) {
+				break
+			}
+			ancestors = append(ancestors, dir)
+		} else if _, err := fs.Stat(dir); err == nil {
+			// An existing directory outside the cgroup filesystem.
+			break
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	return ancestors
+}
+
+// subtreeControlWritable reports whether the controllers enabled for the
+// children of the cgroup at dir can be changed.
+func subtreeControlWritable(dir string) bool {
+	err := syscall.Access(filepath.Join(dir, "cgroup.subtree_control"), unixWOK)
+	return !errors.Is(err, syscall.EACCES) && !errors.Is(err, syscall.EPERM) && !errors.Is(err, syscall.EROFS)
+}
+
+// controllerSource returns the nearest ancestor of path whose cgroup.controllers
+// lists controller. The controller has to be enabled from there down to path.
+func controllerSource(fs FileSystem, path, controller string) (string, error) {
+	for _, dir := range cgroupAncestors(fs, path) {
+		controllers, err := readControllers(fs, dir)
+		if err != nil {
+			return "", err
+		}
+		if slices.Contains(controllers, controller) {
+			return dir, nil
+		}
+	}
+	return "", &ControllerUnavailableError{Controller: controller, Path: path}
+}
+
+// enableControllerInAncestors enables a controller in the cgroup.subtree_control
+// of the ancestors of path, from the nearest one that has it available down.
+func enableControllerInAncestors(fs FileSystem, path, controller string) error {
+	source, err := controllerSource(fs, path, controller)
+	if err != nil {
+		return err
+	}
+
+	var ancestors []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		ancestors = append(ancestors, dir)
+		if dir == source || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		if err := writeCgroupFile(fs, ancestors[i], "cgroup.subtree_control", "+"+controller); err != nil {
+			return fmt.Errorf("failed to enable %s controller in %s: %w", controller, ancestors[i], err)
+		}
+	}
+	return nil
+}
+
+// availableSubsystems returns the subsystems whose controller can be enabled
+// for the cgroup at path. In best-effort mode the others are skipped with a
+// warning; otherwise the first unavailable controller is an error.
+func availableSubsystems(fs FileSystem, path string, subsystems []SubSystem, bestEffort bool) ([]SubSystem, error) {
+	var available []SubSystem
+	for _, s := range subsystems {
+		if _, err := controllerSource(fs, path, s.Name()); err != nil {
+			if !bestEffort {
+				return nil, err
+			}
+			log.Printf("cgroup: warning: skipping %s limits: %v", s.Name(), err)
+			continue
+		}
+		available = append(available, s)
+	}
+	return available, nil
+}
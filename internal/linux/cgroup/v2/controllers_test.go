@@ -0,0 +1,76 @@
+package cgroup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCgroupManagerSetupEnablesAvailableControllers(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"cgroup.controllers": "cpu memory pids\n"})
+
+	memMax := int64(1 << 20)
+	subsystems := func() []SubSystem {
+		return []SubSystem{&MemorySubSystem{Max: &memMax}, &RDMASubsystem{}}
+	}
+
+	m := NewCgroupManager("/abc", subsystems())
+	m.SetRoot(root)
+	var unavailableErr *ControllerUnavailableError
+	if err := m.Setup(); !errors.As(err, &unavailableErr) || unavailableErr.Controller != "rdma" {
+		t.Fatalf("Setup error = %v, want the rdma controller to be unavailable", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "abc")); !os.IsNotExist(err) {
+		t.Errorf("cgroup was created although Setup failed")
+	}
+
+	m = NewCgroupManager("/abc", subsystems())
+	m.SetRoot(root)
+	m.SetBestEffort(true)
+	if err := m.Setup(); err != nil {
+		t.Fatalf("best-effort Setup failed: %v", err)
+	}
+
+	subtreeControl, err := os.ReadFile(filepath.Join(root, "cgroup.subtree_control"))
+	if err != nil || string(subtreeControl) != "+memory" {
+		t.Errorf("cgroup.subtree_control = %q, %v, want \"+memory\"", subtreeControl, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "abc", "memory.max")); err != nil {
+		t.Errorf("memory.max was not written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "abc", "rdma.max")); !os.IsNotExist(err) {
+		t.Errorf("rdma.max was written although rdma is unavailable")
+	}
+}
+
+func TestEnableControllerInAncestorsStartsAtNearestSource(t *testing.T) {
+	root := t.TempDir()
+	parent := filepath.Join(root, "parent")
+	if err := os.MkdirAll(filepath.Join(parent, "child"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, root, map[string]string{"cgroup.controllers": "cpu memory\n"})
+	writeFiles(t, parent, map[string]string{"cgroup.controllers": "memory\n"})
+
+	if err := enableControllerInAncestors(OSFileSystem{}, filepath.Join(parent, "child"), "cpu"); err != nil {
+		t.Fatalf("enableControllerInAncestors failed: %v", err)
+	}
+	for _, dir := range []string{root, parent} {
+		content, err := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+		if err != nil || string(content) != "+cpu" {
+			t.Errorf("%s/cgroup.subtree_control = %q, %v, want \"+cpu\"", dir, content, err)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(root, "cgroup.subtree_control")); err != nil {
+		t.Fatal(err)
+	}
+	if err := enableControllerInAncestors(OSFileSystem{}, filepath.Join(parent, "child"), "memory"); err != nil {
+		t.Fatalf("enableControllerInAncestors failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "cgroup.subtree_control")); !os.IsNotExist(err) {
+		t.Errorf("memory was enabled above the nearest cgroup that has it available")
+	}
+}
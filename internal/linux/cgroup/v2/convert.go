@@ -0,0 +1,63 @@
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ConvertCPUSharesToWeight converts cgroup v1 cpu.shares, in the range
+// [2, 262144], to cgroup v2 cpu.weight, in the range [1, 10000].
+// Zero shares means unset and converts to zero.
+func ConvertCPUSharesToWeight(shares uint64) uint64 {
+	if shares == 0 {
+		return 0
+	}
+	if shares < 2 {
+		shares = 2
+	}
+	if shares > 262144 {
+		shares = 262144
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
+
+// ConvertMemorySwapToV2 converts the OCI swap value, which limits memory and
+// swap combined, to cgroup v2 memory.swap.max, which limits swap alone.
+// A memory or swap value of -1 means unlimited and zero means unset.
+// The returned value is -1 for "max" and zero when nothing should be written.
+func ConvertMemorySwapToV2(memory, memorySwap int64) (int64, error) {
+	// Unlimited memory with no explicit swap means unlimited swap as well,
+	// matching the cgroup v1 behaviour.
+	if memory == -1 && memorySwap == 0 {
+		return -1, nil
+	}
+	if memorySwap == -1 || memorySwap == 0 {
+		return memorySwap, nil
+	}
+	if memory == 0 || memory == -1 {
+		return 0, errors.New("cgroup: unable to set a swap limit without a memory limit")
+	}
+	if memory < 0 || memorySwap < 0 {
+		return 0, fmt.Errorf("cgroup: invalid memory value %d or swap value %d", memory, memorySwap)
+	}
+	if memorySwap < memory {
+		return 0, fmt.Errorf("cgroup: memory+swap limit %d must not be less than the memory limit %d", memorySwap, memory)
+	}
+	return memorySwap - memory, nil
+}
+
+// ConvertBlkIOToIOWeight converts a cgroup v1 blkio weight, in the range
+// [10, 1000], to a cgroup v2 io.weight, in the range [1, 10000].
+// Zero means unset and converts to zero.
+func ConvertBlkIOToIOWeight(weight uint16) uint64 {
+	if weight == 0 {
+		return 0
+	}
+	if weight < 10 {
+		weight = 10
+	}
+	if weight > 1000 {
+		weight = 1000
+	}
+	return 1 + (uint64(weight)-10)*9999/990
+}
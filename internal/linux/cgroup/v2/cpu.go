@@ -6,54 +6,76 @@ import (
 )
 
 // CPUSubSystem is a struct that holds settings and statistics for the CPU controller in cgroup v2.
+// A nil field leaves the corresponding file at its kernel default.
 type CPUSubSystem struct {
 	// cpu.max: Sets the CPU bandwidth limit for the group.
 	// Quota corresponds to the $MAX value; -1 means 'max' (unlimited).
-	Quota int64
+	Quota *int64
 	// Period corresponds to the $PERIOD value.
-	Period uint64
+	Period *uint64
 
 	// cpu.weight: CPU time distribution weight (1 ~ 10000)
-	Weight uint64
+	Weight *uint64
 
 	// cpu.max.burst: Additional CPU burst time available within the period
-	MaxBurst uint64
+	MaxBurst *uint64
 
 	// cpu.idle: Sets the cgroup to idle state (0 or 1)
-	Idle int64
-}
-
-// PressureStall represents pressure stall information (PSI) for a specific resource.
-type PressureStall struct {
-	Avg10  float64 // Average over last 10 seconds
-	Avg60  float64 // Average over last 60 seconds
-	Avg300 float64 // Average over last 300 seconds (5 minutes)
-	Total  uint64  // Accumulated time (microseconds)
-}
-
-// CPUPressure represents pressure stall information (PSI) from the cpu.pressure file.
-type CPUPressure struct {
-	Some PressureStall // Some pressure stall information
-	Full PressureStall // Full pressure stall information
+	Idle *int64
 }
 
 func (c *CPUSubSystem) Name() string {
 	return "cpu"
 }
 
-func (c *CPUSubSystem) Setup(path string) error {
-	files := []CgroupFile{
-		{"cpu.weight", strconv.FormatUint(c.Weight, 10)},
-		{"cpu.max", fmt.Sprintf("%d %d", c.Quota, c.Period)},
-		{"cpu.max.burst", strconv.FormatUint(c.MaxBurst, 10)},
-		{"cpu.idle", strconv.FormatInt(c.Idle, 10)},
+// Apply applies the CPU weight, bandwidth limit, burst and idle settings.
+func (c *CPUSubSystem) Apply(fs FileSystem, path string) error {
+	var files []CgroupFile
+	if c.Weight != nil {
+		files = append(files, CgroupFile{"cpu.weight", strconv.FormatUint(*c.Weight, 10)})
+	}
+	if c.Quota != nil || c.Period != nil {
+		// Without a period, only the quota is written and the period is kept.
+		quota := "max"
+		if c.Quota != nil {
+			quota = formatLimit(*c.Quota)
+		}
+		if c.Period != nil {
+			quota += " " + strconv.FormatUint(*c.Period, 10)
+		}
+		files = append(files, CgroupFile{"cpu.max", quota})
+	}
+	if c.MaxBurst != nil {
+		files = append(files, CgroupFile{"cpu.max.burst", strconv.FormatUint(*c.MaxBurst, 10)})
+	}
+	if c.Idle != nil {
+		files = append(files, CgroupFile{"cpu.idle", strconv.FormatInt(*c.Idle, 10)})
 	}
 
 	for _, f := range files {
-		if err := writeCgroupFile(path, f.Filename, f.Value); err != nil {
+		if err := writeCgroupFile(fs, path, f.Filename, f.Value); err != nil {
 			return fmt.Errorf("cpu subsystem: failed to set %s: %w", f.Filename, err)
 		}
 	}
 
 	return nil
 }
+
+// Stat reads the usage and throttling counters from cpu.stat.
+func (c *CPUSubSystem) Stat(fs FileSystem, path string, stats *Stats) error {
+	values, err := readKeyValues(fs, path, "cpu.stat")
+	if err != nil {
+		return fmt.Errorf("cpu subsystem: %w", err)
+	}
+	stats.CPU = &CPUStats{
+		UsageUsec:     values["usage_usec"],
+		UserUsec:      values["user_usec"],
+		SystemUsec:    values["system_usec"],
+		NrPeriods:     values["nr_periods"],
+		NrThrottled:   values["nr_throttled"],
+		ThrottledUsec: values["throttled_usec"],
+		NrBursts:      values["nr_bursts"],
+		BurstUsec:     values["burst_usec"],
+	}
+	return nil
+}
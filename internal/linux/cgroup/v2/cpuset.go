@@ -0,0 +1,140 @@
+package cgroup
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CpusetSubSystem defines the CPUs and memory nodes a cgroup may use.
+// Empty fields leave the corresponding file at its kernel default.
+type CpusetSubSystem struct {
+	// cpuset.cpus: CPU list such as "0-3,8"
+	Cpus string
+	// cpuset.mems: memory node list such as "0-1"
+	Mems string
+	// cpuset.cpus.partition: "member", "root" or "isolated"
+	Partition string
+}
+
+func (c *CpusetSubSystem) Name() string {
+	return "cpuset"
+}
+
+// Apply checks the requested lists against the parent's effective sets and
+// applies them. Enabling the controller is left to the manager.
+func (c *CpusetSubSystem) Apply(fs FileSystem, path string) error {
+	parent := filepath.Dir(path)
+	if err := checkListSubset(fs, c.Cpus, parent, "cpuset.cpus.effective"); err != nil {
+		return fmt.Errorf("cpuset subsystem: invalid cpus: %w", err)
+	}
+	if err := checkListSubset(fs, c.Mems, parent, "cpuset.mems.effective"); err != nil {
+		return fmt.Errorf("cpuset subsystem: invalid mems: %w", err)
+	}
+
+	switch c.Partition {
+	case "", "member", "root", "isolated":
+	default:
+		return fmt.Errorf("cpuset subsystem: invalid partition type %q", c.Partition)
+	}
+
+	var files []CgroupFile
+	if c.Cpus != "" {
+		files = append(files, CgroupFile{"cpuset.cpus", c.Cpus})
+	}
+	if c.Mems != "" {
+		files = append(files, CgroupFile{"cpuset.mems", c.Mems})
+	}
+	if c.Partition != "" {
+		files = append(files, CgroupFile{"cpuset.cpus.partition", c.Partition})
+	}
+
+	for _, f := range files {
+		if err := writeCgroupFile(fs, path, f.Filename, f.Value); err != nil {
+			return fmt.Errorf("cpuset subsystem: failed to set %s: %w", f.Filename, err)
+		}
+	}
+	return nil
+}
+
+// Stat reads the effective CPU and memory node lists.
+func (c *CpusetSubSystem) Stat(fs FileSystem, path string, stats *Stats) error {
+	cpusetStats := &CpusetStats{}
+	var err error
+	if cpusetStats.CpusEffective, err = readCgroupFile(fs, path, "cpuset.cpus.effective"); err != nil {
+		return fmt.Errorf("cpuset subsystem: failed to read cpuset.cpus.effective: %w", err)
+	}
+	if cpusetStats.MemsEffective, err = readCgroupFile(fs, path, "cpuset.mems.effective"); err != nil {
+		return fmt.Errorf("cpuset subsystem: failed to read cpuset.mems.effective: %w", err)
+	}
+	stats.Cpuset = cpusetStats
+	return nil
+}
+
+// maxListMember is the largest CPU or memory node number a cpuset list may
+// name, the kernel's upper bound for CONFIG_NR_CPUS. It keeps a list such as
+// "0-2147483647" from being expanded member by member.
+const maxListMember = 8191
+
+// ParseList parses a cpuset list such as "0-3,8,10-11" into its members.
+func ParseList(list string) (map[int]struct{}, error) {
+	members := make(map[int]struct{})
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return members, nil
+	}
+
+	for _, part := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("cgroup: invalid list element %q", part)
+		}
+		if start > maxListMember {
+			return nil, fmt.Errorf("cgroup: list element %q exceeds the maximum of %d", part, maxListMember)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(last)
+			if err != nil || end < start {
+				return nil, fmt.Errorf("cgroup: invalid list range %q", part)
+			}
+			if end > maxListMember {
+				return nil, fmt.Errorf("cgroup: list range %q exceeds the maximum of %d", part, maxListMember)
+			}
+		}
+		for i := start; i <= end; i++ {
+			members[i] = struct{}{}
+		}
+	}
+	return members, nil
+}
+
+// checkListSubset verifies that every member of list is present in the given
+// effective list file of the parent cgroup.
+func checkListSubset(fs FileSystem, list, parent, filename string) error {
+	if list == "" {
+		return nil
+	}
+	requested, err := ParseList(list)
+	if err != nil {
+		return err
+	}
+
+	content, err := fs.ReadFile(filepath.Join(parent, filename))
+	if err != nil {
+		return fmt.Errorf("failed to read parent %s: %w", filename, err)
+	}
+	available, err := ParseList(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse parent %s: %w", filename, err)
+	}
+
+	for member := range requested {
+		if _, ok := available[member]; !ok {
+			return fmt.Errorf("%d is not in the parent's %s %q", member, filename, strings.TrimSpace(string(content)))
+		}
+	}
+	return nil
+}
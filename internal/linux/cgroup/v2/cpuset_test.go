@@ -0,0 +1,65 @@
+package cgroup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	tests := map[string][]int{
+		"":            nil,
+		"0":           {0},
+		" 0-3,8\n":    {0, 1, 2, 3, 8},
+		"10-11,10":    {10, 11},
+		"8190-8191":   {8190, 8191},
+		"4-4":         {4},
+		"0,2,4,6-7,1": {0, 1, 2, 4, 6, 7},
+	}
+	for list, want := range tests {
+		got, err := ParseList(list)
+		if err != nil {
+			t.Errorf("ParseList(%q): %v", list, err)
+			continue
+		}
+		wantSet := make(map[int]struct{})
+		for _, member := range want {
+			wantSet[member] = struct{}{}
+		}
+		if !reflect.DeepEqual(got, wantSet) {
+			t.Errorf("ParseList(%q) = %v, want %v", list, got, wantSet)
+		}
+	}
+
+	for _, list := range []string{"-1", "a", "3-1", "0-", "1,,2", "8192", "0-8192", "0-2147483647"} {
+		if _, err := ParseList(list); err == nil {
+			t.Errorf("ParseList(%q) succeeded, want error", list)
+		}
+	}
+}
+
+func TestCpusetApplyLeavesControllersAlone(t *testing.T) {
+	fs := newFakeCgroupFS(t, "cpuset")
+	if err := fs.MkdirAll(fs.root + "/ctr"); err != nil {
+		t.Fatal(err)
+	}
+	// Stand in for a controller someone else enabled, without touching
+	// cgroup.subtree_control.
+	fs.set(t, "/ctr", "cpuset.cpus", "\n")
+	fs.set(t, "/ctr", "cpuset.mems", "\n")
+
+	c := &CpusetSubSystem{Cpus: "1-2", Mems: "0"}
+	if err := c.Apply(fs, fs.root+"/ctr"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.read(t, "/", "cgroup.subtree_control"); got != "" {
+		t.Errorf("cgroup.subtree_control = %q, want Apply to leave it alone", got)
+	}
+	if got := fs.read(t, "/ctr", "cpuset.cpus"); got != "1-2" {
+		t.Errorf("cpuset.cpus = %q, want 1-2", got)
+	}
+
+	c = &CpusetSubSystem{Cpus: "4"}
+	if err := c.Apply(fs, fs.root+"/ctr"); err == nil {
+		t.Error("Apply with a CPU outside the parent's effective set succeeded")
+	}
+}
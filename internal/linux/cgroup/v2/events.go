@@ -0,0 +1,153 @@
+package cgroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// waitCgroupEvents waits until done reports true for the keys of the
+// cgroup.events file of the cgroup at path, or until timeout passes. The
+// kernel signals changes to the file as inotify modify events, so no polling
+// interval is involved.
+func waitCgroupEvents(fs FileSystem, path string, timeout time.Duration, done func(events map[string]uint64) bool) error {
+	watcher, err := newFileWatcher(filepath.Join(path, "cgroup.events"))
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		// Reading after the watch is added makes sure no change is missed.
+		events, err := readKeyValues(fs, path, "cgroup.events")
+		if err != nil {
+			return err
+		}
+		if done(events) {
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("timed out after %s waiting on %s/cgroup.events", timeout, path)
+		}
+		if err := watcher.Wait(remaining); err != nil {
+			return err
+		}
+	}
+}
+
+// watchInterval bounds how long WatchEvents blocks before checking whether it
+// should stop, independently of file changes.
+const watchInterval = time.Second
+
+// limitEvents lists the keyed files watched for limit events and the keys
+// reported from each of them.
+var limitEvents = []struct {
+	filename string
+	keys     []string
+}{
+	{"memory.events", []string{"max", "oom", "oom_kill", "oom_group_kill"}},
+	{"memory.swap.events", []string{"max", "fail"}},
+	{"pids.events", []string{"max"}},
+}
+
+// EventCounts maps an event type, such as "memory.oom_kill", to the number of
+// times it occurred.
+type EventCounts map[string]uint64
+
+// Event reports that a limit event occurred in a cgroup.
+type Event struct {
+	// Type is the event file's prefix and key, such as "memory.oom" (the
+	// cgroup hit its memory limit and the OOM killer was invoked),
+	// "memory.oom_kill" (a process was OOM-killed), "memory.oom_group_kill"
+	// (the whole cgroup was OOM-killed) or "pids.max" (a fork failed).
+	Type string
+	// Count is the number of times the event occurred in total.
+	Count uint64
+}
+
+// ReadEventCounts reads the limit event counters of the cgroup at path.
+// Counters of controllers that are not enabled read as zero.
+func ReadEventCounts(path string) (EventCounts, error) {
+	counts := make(EventCounts)
+	for _, e := range limitEvents {
+		values, err := readKeyValues(OSFileSystem{}, path, e.filename)
+		if err != nil {
+			return nil, fmt.Errorf("cgroup: %w", err)
+		}
+		prefix := strings.TrimSuffix(e.filename, ".events")
+		for _, key := range e.keys {
+			counts[prefix+"."+key] = values[key]
+		}
+	}
+	return counts, nil
+}
+
+// newEvents returns the events whose count grew from previous to current,
+// sorted by type.
+func newEvents(previous, current EventCounts) []Event {
+	var events []Event
+	for eventType, count := range current {
+		if count > previous[eventType] {
+			events = append(events, Event{Type: eventType, Count: count})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Type < events[j].Type })
+	return events
+}
+
+// WatchEvents calls handle for every limit event of the cgroup at path that is
+// not already counted in since, until ctx is done or the cgroup is removed.
+// The event files are watched with inotify.
+func WatchEvents(ctx context.Context, path string, since EventCounts, handle func(Event) error) error {
+	var files []string
+	for _, e := range limitEvents {
+		file := filepath.Join(path, e.filename)
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("cgroup: %s has no memory or pids event files to watch", path)
+	}
+
+	watcher, err := newFileWatcher(files...)
+	if err != nil {
+		return fmt.Errorf("cgroup: %w", err)
+	}
+	defer watcher.Close()
+
+	counts := make(EventCounts)
+	for eventType, count := range since {
+		counts[eventType] = count
+	}
+	for {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		current, err := ReadEventCounts(path)
+		if err != nil {
+			return err
+		}
+		for _, event := range newEvents(counts, current) {
+			if err := handle(event); err != nil {
+				return err
+			}
+			counts[event.Type] = event.Count
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := watcher.Wait(watchInterval); err != nil {
+			return fmt.Errorf("cgroup: %w", err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package cgroup
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchEvents(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"memory.events": "low 0\nhigh 0\nmax 4\noom 1\noom_kill 0\noom_group_kill 0\n",
+		"pids.events":   "max 0\n",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan Event, 16)
+	done := make(chan error, 1)
+	since := EventCounts{"memory.max": 4}
+	go func() {
+		done <- WatchEvents(ctx, dir, since, func(e Event) error {
+			events <- e
+			return nil
+		})
+	}()
+
+	// The OOM that happened before watching is reported, the max hits are not.
+	expectEvents(t, events, []Event{{Type: "memory.oom", Count: 1}})
+
+	writeFiles(t, dir, map[string]string{
+		"memory.events": "low 0\nhigh 0\nmax 4\noom 2\noom_kill 1\noom_group_kill 1\n",
+	})
+	expectEvents(t, events, []Event{
+		{Type: "memory.oom", Count: 2},
+		{Type: "memory.oom_group_kill", Count: 1},
+		{Type: "memory.oom_kill", Count: 1},
+	})
+
+	writeFiles(t, dir, map[string]string{"pids.events": "max 3\n"})
+	expectEvents(t, events, []Event{{Type: "pids.max", Count: 3}})
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("WatchEvents failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchEvents did not stop after its context was canceled")
+	}
+}
+
+func expectEvents(t *testing.T, events <-chan Event, want []Event) {
+	t.Helper()
+	var got []Event
+	for range want {
+		select {
+		case e := <-events:
+			got = append(got, e)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got events %v, want %v", got, want)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+}
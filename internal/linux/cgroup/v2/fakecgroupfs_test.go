@@ -0,0 +1,450 @@
+package cgroup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// fakeFile describes an interface file of the fake cgroup filesystem.
+type fakeFile struct {
+	content string
+	// readOnly files reject every write, like the kernel's statistics files.
+	readOnly bool
+	// valid reports whether a written value is accepted. Rejected values fail
+	// with EINVAL.
+	valid func(value string) bool
+	// merge returns the content of a file keyed by device, such as io.max,
+	// after a line is written to it, or false to reject the line with EINVAL.
+	merge func(content, line string) (string, bool)
+}
+
+// fakeCoreFiles are the files of every cgroup, whatever controllers it has.
+var fakeCoreFiles = map[string]fakeFile{
+	"cgroup.procs":  {valid: isUint},
+	"cgroup.events": {content: "populated 0\nfrozen 0\n", readOnly: true},
+	"cgroup.freeze": {content: "0\n", valid: oneOf("0", "1")},
+	"cpu.stat":      {content: "usage_usec 0\nuser_usec 0\nsystem_usec 0\n", readOnly: true},
+}
+
+// fakeControllerFiles are the files a cgroup has for each controller enabled
+// in its parent's cgroup.subtree_control.
+var fakeControllerFiles = map[string]map[string]fakeFile{
+	"cpu": {
+		"cpu.weight":    {content: "100\n", valid: inRange(1, 10000)},
+		"cpu.max":       {content: "max 100000\n", valid: isCPUMax},
+		"cpu.max.burst": {content: "0\n", valid: isUint},
+		"cpu.idle":      {content: "0\n", valid: oneOf("0", "1")},
+	},
+	"cpuset": {
+		"cpuset.cpus":           {},
+		"cpuset.mems":           {},
+		"cpuset.cpus.effective": {content: "0-3\n", readOnly: true},
+		"cpuset.mems.effective": {content: "0\n", readOnly: true},
+		"cpuset.cpus.partition": {content: "member\n", valid: oneOf("member", "root", "isolated")},
+	},
+	"memory": {
+		"memory.current":      {content: "0\n", readOnly: true},
+		"memory.peak":         {content: "0\n", readOnly: true},
+		"memory.min":          {content: "0\n", valid: isUintOrMax},
+		"memory.low":          {content: "0\n", valid: isUintOrMax},
+		"memory.high":         {content: "max\n", valid: isUintOrMax},
+		"memory.max":          {content: "max\n", valid: isUintOrMax},
+		"memory.swap.current": {content: "0\n", readOnly: true},
+		"memory.swap.high":    {content: "max\n", valid: isUintOrMax},
+		"memory.swap.max":     {content: "max\n", valid: isUintOrMax},
+		"memory.oom.group":    {content: "0\n", valid: oneOf("0", "1")},
+		"memory.events":       {content: "low 0\nhigh 0\nmax 0\noom 0\noom_kill 0\noom_group_kill 0\n", readOnly: true},
+		"memory.stat":         {content: "anon 0\nfile 0\n", readOnly: true},
+		"memory.reclaim":      {valid: isReclaim},
+	},
+	"pids": {
+		"pids.max":     {content: "max\n", valid: isUintOrMax},
+		"pids.current": {content: "0\n", readOnly: true},
+		"pids.peak":    {content: "0\n", readOnly: true},
+		"pids.events":  {content: "max 0\n", readOnly: true},
+	},
+	"io": {
+		"io.weight": {content: "default 100\n", merge: mergeIOWeight},
+		"io.max":    {merge: mergeIOMax},
+		"io.stat":   {readOnly: true},
+	},
+	"hugetlb": {
+		"hugetlb.2MB.max":          {content: "max\n", valid: isUintOrMax},
+		"hugetlb.2MB.rsvd.max":     {content: "max\n", valid: isUintOrMax},
+		"hugetlb.2MB.current":      {content: "0\n", readOnly: true},
+		"hugetlb.2MB.rsvd.current": {content: "0\n", readOnly: true},
+		"hugetlb.2MB.events":       {content: "max 0\n", readOnly: true},
+	},
+	"rdma": {
+		"rdma.max":     {},
+		"rdma.current": {readOnly: true},
+	},
+	"misc": {
+		"misc.max":     {valid: isMiscMax},
+		"misc.current": {readOnly: true},
+		"misc.events":  {readOnly: true},
+	},
+}
+
+func isUint(value string) bool {
+	_, err := strconv.ParseUint(value, 10, 64)
+	return err == nil
+}
+
+func isUintOrMax(value string) bool {
+	return value == "max" || isUint(value)
+}
+
+func oneOf(values ...string) func(string) bool {
+	return func(value string) bool { return slices.Contains(values, value) }
+}
+
+func inRange(lo, hi uint64) func(string) bool {
+	return func(value string) bool {
+		n, err := strconv.ParseUint(value, 10, 64)
+		return err == nil && n >= lo && n <= hi
+	}
+}
+
+func isMiscMax(value string) bool {
+	fields := strings.Fields(value)
+	return len(fields) == 2 && isUintOrMax(fields[1])
+}
+
+func isReclaim(value string) bool {
+	amount, swappiness, ok := strings.Cut(value, " swappiness=")
+	return isUint(amount) && (!ok || inRange(0, 200)(swappiness))
+}
+
+func isDevice(value string) bool {
+	var major, minor uint64
+	_, err := fmt.Sscanf(value, "%d:%d", &major, &minor)
+	return err == nil && value == fmt.Sprintf("%d:%d", major, minor)
+}
+
+// setKeyedLine replaces the line of content that starts with key, appending
+// it if there is none. An empty line removes it.
+func setKeyedLine(content, key, line string) string {
+	var lines []string
+	found := false
+	for _, l := range strings.Split(content, "\n") {
+		switch {
+		case l == "":
+			continue
+		case strings.HasPrefix(l, key+" "):
+			found = true
+			if line == "" {
+				continue
+			}
+			l = line
+		}
+		lines = append(lines, l)
+	}
+	if !found && line != "" {
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// mergeIOMax updates the limits of one device like the kernel: limits that
+// are not written keep their value, unset ones read as max, and a device
+// without limits is not listed.
+func mergeIOMax(content, line string) (string, bool) {
+	dev, settings, _ := strings.Cut(line, " ")
+	if !isDevice(dev) {
+		return "", false
+	}
+	keys := []string{"rbps", "wbps", "riops", "wiops"}
+	values := map[string]string{"rbps": "max", "wbps": "max", "riops": "max", "wiops": "max"}
+	for _, l := range strings.Split(content, "\n") {
+		if fields := strings.Fields(l); len(fields) > 0 && fields[0] == dev {
+			for _, field := range fields[1:] {
+				key, value, _ := strings.Cut(field, "=")
+				values[key] = value
+			}
+		}
+	}
+	for _, field := range strings.Fields(settings) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || !slices.Contains(keys, key) || !isUintOrMax(value) {
+			return "", false
+		}
+		values[key] = value
+	}
+
+	merged := dev
+	limited := false
+	for _, key := range keys {
+		merged += " " + key + "=" + values[key]
+		limited = limited || values[key] != "max"
+	}
+	if !limited {
+		merged = ""
+	}
+	return setKeyedLine(content, dev, merged), true
+}
+
+// mergeIOWeight updates the default weight or the weight of one device like
+// the kernel. Writing "default" as a device weight removes it.
+func mergeIOWeight(content, line string) (string, bool) {
+	key, weight, ok := strings.Cut(line, " ")
+	switch {
+	case !ok:
+		return "", false
+	case key != "default" && !isDevice(key):
+		return "", false
+	case key != "default" && weight == "default":
+		return setKeyedLine(content, key, ""), true
+	case !inRange(1, 10000)(weight):
+		return "", false
+	}
+	return setKeyedLine(content, key, line), true
+}
+
+func isCPUMax(value string) bool {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 || !isUintOrMax(fields[0]) {
+		return false
+	}
+	return len(fields) == 1 || isUint(fields[1])
+}
+
+// fakeCgroupFS emulates a cgroup v2 filesystem in a temporary directory. New
+// cgroups get the interface files of the controllers enabled in their
+// parent's cgroup.subtree_control, writes to cgroup.subtree_control check
+// cgroup.controllers and propagate to the children, read-only files reject
+// writes, and written values are validated.
+type fakeCgroupFS struct {
+	root string
+}
+
+// newFakeCgroupFS creates a fake cgroup filesystem whose root cgroup has the
+// given controllers available.
+func newFakeCgroupFS(t *testing.T, controllers ...string) *fakeCgroupFS {
+	t.Helper()
+	fs := &fakeCgroupFS{root: t.TempDir()}
+	if err := fs.populate(fs.root, controllers); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+// contains reports whether name is the fake root or below it.
+func (fs *fakeCgroupFS) contains(name string) bool {
+	rel, err := filepath.Rel(fs.root, name)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+func (fs *fakeCgroupFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (fs *fakeCgroupFS) ReadDir(name string) ([]os.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (fs *fakeCgroupFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (fs *fakeCgroupFS) MkdirAll(path string) error {
+	if !fs.contains(path) {
+		return os.MkdirAll(path, 0o755)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := fs.MkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+	if err := os.Mkdir(path, 0o755); err != nil {
+		return err
+	}
+	return fs.populate(path, fs.subtreeControl(filepath.Dir(path)))
+}
+
+// populate creates the interface files of a new cgroup with controllers available.
+func (fs *fakeCgroupFS) populate(dir string, controllers []string) error {
+	files := map[string]string{
+		"cgroup.controllers":     strings.Join(controllers, " ") + "\n",
+		"cgroup.subtree_control": "\n",
+	}
+	for name, f := range fakeCoreFiles {
+		files[name] = f.content
+	}
+	for _, controller := range controllers {
+		for name, f := range fakeControllerFiles[controller] {
+			files[name] = f.content
+		}
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *fakeCgroupFS) WriteFile(name, value string) error {
+	if !fs.contains(name) {
+		return os.WriteFile(name, []byte(value), 0o600)
+	}
+	dir, filename := filepath.Split(name)
+	dir = filepath.Clean(dir)
+	fail := func(err error) error {
+		return &os.PathError{Op: "write", Path: name, Err: err}
+	}
+
+	if _, err := os.Stat(name); err != nil {
+		// The kernel does not let files be created in a cgroup.
+		return fail(syscall.EACCES)
+	}
+	if filename == "cgroup.subtree_control" {
+		return fs.writeSubtreeControl(dir, value, fail)
+	}
+	if filename == "cgroup.controllers" {
+		return fail(syscall.EACCES)
+	}
+
+	f, ok := fakeCoreFiles[filename]
+	for _, files := range fakeControllerFiles {
+		if ok {
+			break
+		}
+		f, ok = files[filename]
+	}
+	if f.readOnly {
+		return fail(syscall.EACCES)
+	}
+	if f.valid != nil && !f.valid(strings.TrimSpace(value)) {
+		return fail(syscall.EINVAL)
+	}
+	if f.merge != nil {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		merged, ok := f.merge(string(content), strings.TrimSpace(value))
+		if !ok {
+			return fail(syscall.EINVAL)
+		}
+		value = merged
+	}
+	return os.WriteFile(name, []byte(value), 0o644)
+}
+
+// writeSubtreeControl applies "+controller" and "-controller" changes to the
+// controllers enabled for the children of dir.
+func (fs *fakeCgroupFS) writeSubtreeControl(dir, value string, fail func(error) error) error {
+	available := fs.readList(dir, "cgroup.controllers")
+	enabled := fs.subtreeControl(dir)
+	children := fs.children(dir)
+
+	for _, change := range strings.Fields(value) {
+		controller := change[1:]
+		switch {
+		case change[0] == '+':
+			if !slices.Contains(available, controller) {
+				return fail(syscall.ENOENT)
+			}
+			if !slices.Contains(enabled, controller) {
+				enabled = append(enabled, controller)
+			}
+		case change[0] == '-':
+			for _, child := range children {
+				if slices.Contains(fs.subtreeControl(child), controller) {
+					return fail(syscall.EBUSY)
+				}
+			}
+			enabled = slices.DeleteFunc(enabled, func(c string) bool { return c == controller })
+		default:
+			return fail(syscall.EINVAL)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte(strings.Join(enabled, " ")+"\n"), 0o644); err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := fs.setControllers(child, enabled); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setControllers updates the controllers available in dir, adding and removing
+// their interface files.
+func (fs *fakeCgroupFS) setControllers(dir string, controllers []string) error {
+	for _, controller := range fs.readList(dir, "cgroup.controllers") {
+		if slices.Contains(controllers, controller) {
+			continue
+		}
+		for name := range fakeControllerFiles[controller] {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, controller := range controllers {
+		for name, f := range fakeControllerFiles[controller] {
+			file := filepath.Join(dir, name)
+			if _, err := os.Stat(file); err == nil {
+				continue
+			}
+			if err := os.WriteFile(file, []byte(f.content), 0o644); err != nil {
+				return err
+			}
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte(strings.Join(controllers, " ")+"\n"), 0o644)
+}
+
+func (fs *fakeCgroupFS) subtreeControl(dir string) []string {
+	return fs.readList(dir, "cgroup.subtree_control")
+}
+
+func (fs *fakeCgroupFS) readList(dir, filename string) []string {
+	content, _ := os.ReadFile(filepath.Join(dir, filename))
+	return strings.Fields(string(content))
+}
+
+func (fs *fakeCgroupFS) children(dir string) []string {
+	entries, _ := os.ReadDir(dir)
+	var children []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			children = append(children, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return children
+}
+
+// read returns the trimmed content of a file of the cgroup at path, relative
+// to the fake root.
+func (fs *fakeCgroupFS) read(t *testing.T, path, filename string) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(fs.root, path, filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// set overwrites a file of the cgroup at path the way the kernel would update
+// it, bypassing the read-only check.
+func (fs *fakeCgroupFS) set(t *testing.T, path, filename, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(fs.root, path, filename), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,25 +1,198 @@
 package cgroup
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 )
 
+// hugepagesDir lists the huge page sizes the kernel supports, as directories
+// such as "hugepages-2048kB".
+const hugepagesDir = "/sys/kernel/mm/hugepages"
+
+var pageSizePattern = regexp.MustCompile(`^([0-9]+)([KkMG]?)(i?B)?$`)
+
+// HugepageLimit holds the limits of one huge page size. A nil field leaves
+// the corresponding file at its kernel default.
+type HugepageLimit struct {
+	// hugetlb.<size>.max: limit of huge page faults
+	Max *uint64
+	// hugetlb.<size>.rsvd.max: limit of huge page reservations, which also
+	// covers pages reserved by mmap but not faulted in yet
+	RsvdMax *uint64
+}
+
+// HugepageSubSystem defines the hugetlb limits of every page size.
 type HugepageSubSystem struct {
-	Pages map[string]uint64 // map of hugepage size to limit value
+	Limits map[string]HugepageLimit // map of page size, as returned by NormalizePageSize, to its limits
 }
 
 func (h *HugepageSubSystem) Name() string {
 	return "hugetlb"
 }
 
-// Setup applies hugepage subsystem limits.
-func (h *HugepageSubSystem) Setup(path string) error {
-	for pageSize, limit := range h.Pages {
-		filename := "hugetlb." + pageSize + ".max"
-		if err := writeCgroupFile(path, filename, strconv.FormatUint(limit, 10)); err != nil {
-			return fmt.Errorf("hugetlb subsystem: failed to set %s: %w", filename, err)
+// Apply applies hugepage subsystem limits. Reservation limits are skipped on
+// kernels without reservation accounting (before 5.7).
+func (h *HugepageSubSystem) Apply(fs FileSystem, path string) error {
+	pageSizes := make([]string, 0, len(h.Limits))
+	for pageSize := range h.Limits {
+		pageSizes = append(pageSizes, pageSize)
+	}
+	sort.Strings(pageSizes)
+
+	for _, pageSize := range pageSizes {
+		limit := h.Limits[pageSize]
+		if limit.Max != nil {
+			filename := "hugetlb." + pageSize + ".max"
+			if err := writeCgroupFile(fs, path, filename, strconv.FormatUint(*limit.Max, 10)); err != nil {
+				return fmt.Errorf("hugetlb subsystem: failed to set %s: %w", filename, err)
+			}
+		}
+		if limit.RsvdMax != nil {
+			filename := "hugetlb." + pageSize + ".rsvd.max"
+			if _, err := fs.Stat(filepath.Join(path, filename)); errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err := writeCgroupFile(fs, path, filename, strconv.FormatUint(*limit.RsvdMax, 10)); err != nil {
+				return fmt.Errorf("hugetlb subsystem: failed to set %s: %w", filename, err)
+			}
 		}
 	}
 	return nil
 }
+
+// Stat reads the usage, reservations and limit hits of every page size the
+// cgroup accounts, not only the configured ones.
+func (h *HugepageSubSystem) Stat(fs FileSystem, path string, stats *Stats) error {
+	files, err := filepath.Glob(filepath.Join(path, "hugetlb.*.current"))
+	if err != nil {
+		return fmt.Errorf("hugetlb subsystem: %w", err)
+	}
+
+	stats.Hugetlb = make(map[string]HugetlbStats)
+	for _, file := range files {
+		pageSize := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "hugetlb."), ".current")
+		if strings.Contains(pageSize, ".") {
+			// hugetlb.<size>.rsvd.current
+			continue
+		}
+
+		var pageStats HugetlbStats
+		if err := readUint(fs, path, "hugetlb."+pageSize+".current", &pageStats.Current); err != nil {
+			return fmt.Errorf("hugetlb subsystem: %w", err)
+		}
+		if err := readUint(fs, path, "hugetlb."+pageSize+".rsvd.current", &pageStats.RsvdCurrent); err != nil {
+			return fmt.Errorf("hugetlb subsystem: %w", err)
+		}
+		events, err := readKeyValues(fs, path, "hugetlb."+pageSize+".events")
+		if err != nil {
+			return fmt.Errorf("hugetlb subsystem: %w", err)
+		}
+		pageStats.MaxEvents = events["max"]
+		stats.Hugetlb[pageSize] = pageStats
+	}
+	return nil
+}
+
+// NormalizePageSize converts a huge page size such as "2M", "2048kB", "2MiB"
+// or "2MB" to the form used in hugetlb file names, "2MB".
+func NormalizePageSize(size string) (string, error) {
+	bytes, err := parsePageSize(size)
+	if err != nil {
+		return "", err
+	}
+	return formatPageSize(bytes), nil
+}
+
+func parsePageSize(size string) (uint64, error) {
+	match := pageSizePattern.FindStringSubmatch(size)
+	if match == nil {
+		return 0, fmt.Errorf("cgroup: %q is not a valid page size such as 2MB", size)
+	}
+	value, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cgroup: %q is not a valid page size: %w", size, err)
+	}
+	var shift uint
+	switch match[2] {
+	case "K", "k":
+		shift = 10
+	case "M":
+		shift = 20
+	case "G":
+		shift = 30
+	}
+	if value > math.MaxUint64>>shift {
+		return 0, fmt.Errorf("cgroup: page size %q is too large", size)
+	}
+	value <<= shift
+	if value == 0 || value%1024 != 0 {
+		return 0, fmt.Errorf("cgroup: page size %q is not a positive multiple of 1KB", size)
+	}
+	return value, nil
+}
+
+func formatPageSize(bytes uint64) string {
+	switch {
+	case bytes%(1<<30) == 0:
+		return fmt.Sprintf("%dGB", bytes>>30)
+	case bytes%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", bytes>>20)
+	default:
+		return fmt.Sprintf("%dKB", bytes>>10)
+	}
+}
+
+// SupportedPageSizes returns the huge page sizes the kernel supports, in the
+// form returned by NormalizePageSize.
+func SupportedPageSizes() ([]string, error) {
+	return supportedPageSizes(hugepagesDir)
+}
+
+func supportedPageSizes(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cgroup: failed to list huge page sizes: %w", err)
+	}
+
+	var sizes []string
+	for _, entry := range entries {
+		kb, ok := strings.CutPrefix(entry.Name(), "hugepages-")
+		if !ok {
+			continue
+		}
+		bytes, err := parsePageSize(kb)
+		if err != nil {
+			continue
+		}
+		sizes = append(sizes, formatPageSize(bytes))
+	}
+	return sizes, nil
+}
+
+// ValidatePageSize normalizes a huge page size and checks that the kernel
+// supports it.
+func ValidatePageSize(size string) (string, error) {
+	pageSize, err := NormalizePageSize(size)
+	if err != nil {
+		return "", err
+	}
+	supported, err := SupportedPageSizes()
+	if err != nil {
+		return "", err
+	}
+	if !slices.Contains(supported, pageSize) {
+		return "", fmt.Errorf("cgroup: huge page size %s is not supported by this kernel (supported: %s)", pageSize, strings.Join(supported, ", "))
+	}
+	return pageSize, nil
+}
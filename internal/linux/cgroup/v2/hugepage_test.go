@@ -0,0 +1,108 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizePageSize(t *testing.T) {
+	tests := map[string]string{
+		"2MB":    "2MB",
+		"2M":     "2MB",
+		"2MiB":   "2MB",
+		"2048kB": "2MB",
+		"2048KB": "2MB",
+		"1G":     "1GB",
+		"1024MB": "1GB",
+		"64KB":   "64KB",
+		"1536KB": "1536KB",
+	}
+	for size, want := range tests {
+		got, err := NormalizePageSize(size)
+		if err != nil {
+			t.Errorf("NormalizePageSize(%q): %v", size, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("NormalizePageSize(%q) = %q, want %q", size, got, want)
+		}
+	}
+
+	for _, size := range []string{"", "MB", "0MB", "2TB", "100", "-2MB", "17179869184G", "18014398509481984K"} {
+		if _, err := NormalizePageSize(size); err == nil {
+			t.Errorf("NormalizePageSize(%q) succeeded, want error", size)
+		}
+	}
+}
+
+func TestSupportedPageSizes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"hugepages-2048kB", "hugepages-1048576kB", "other"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sizes, err := supportedPageSizes(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1GB", "2MB"}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("supported sizes = %v, want %v", sizes, want)
+	}
+
+	sizes, err = supportedPageSizes(filepath.Join(dir, "missing"))
+	if err != nil || sizes != nil {
+		t.Errorf("missing dir = %v, %v, want no sizes", sizes, err)
+	}
+}
+
+func TestHugepageApplyAndStat(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"hugetlb.2MB.max":          "max\n",
+		"hugetlb.2MB.rsvd.max":     "max\n",
+		"hugetlb.2MB.current":      "4194304\n",
+		"hugetlb.2MB.rsvd.current": "6291456\n",
+		"hugetlb.2MB.events":       "max 2\n",
+		"hugetlb.1GB.max":          "max\n",
+		"hugetlb.1GB.current":      "0\n",
+		"hugetlb.1GB.rsvd.current": "0\n",
+	})
+
+	limit := uint64(8 << 20)
+	h := &HugepageSubSystem{Limits: map[string]HugepageLimit{
+		"2MB": {Max: &limit, RsvdMax: &limit},
+		// No hugetlb.1GB.rsvd.max: the reservation limit is skipped.
+		"1GB": {Max: &limit, RsvdMax: &limit},
+	}}
+	if err := h.Apply(OSFileSystem{}, dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"hugetlb.2MB.max", "hugetlb.2MB.rsvd.max", "hugetlb.1GB.max"} {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != "8388608" {
+			t.Errorf("%s = %q, want 8388608", name, content)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hugetlb.1GB.rsvd.max")); !os.IsNotExist(err) {
+		t.Errorf("hugetlb.1GB.rsvd.max was created")
+	}
+
+	var stats Stats
+	if err := h.Stat(OSFileSystem{}, dir, &stats); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]HugetlbStats{
+		"2MB": {Current: 4 << 20, RsvdCurrent: 6 << 20, MaxEvents: 2},
+		"1GB": {},
+	}
+	if !reflect.DeepEqual(stats.Hugetlb, want) {
+		t.Errorf("hugetlb stats = %+v, want %+v", stats.Hugetlb, want)
+	}
+}
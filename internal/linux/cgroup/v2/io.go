@@ -0,0 +1,183 @@
+package cgroup
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IODevice identifies a block device by its major and minor numbers.
+type IODevice struct {
+	Major int64
+	Minor int64
+}
+
+func (d IODevice) String() string {
+	return fmt.Sprintf("%d:%d", d.Major, d.Minor)
+}
+
+// IOLimit holds the io.max limits of a device. A nil field leaves the limit
+// untouched and zero removes it.
+type IOLimit struct {
+	RBps  *uint64
+	WBps  *uint64
+	RIOps *uint64
+	WIOps *uint64
+}
+
+// IOSubSystem defines the settings of the io controller.
+type IOSubSystem struct {
+	// io.weight: default proportional weight (1 ~ 10000)
+	Weight *uint64
+	// io.weight: per-device weights overriding the default weight
+	DeviceWeights map[IODevice]uint64
+	// io.max: per-device bandwidth and IOPS limits
+	DeviceLimits map[IODevice]IOLimit
+	// io.latency: per-device latency targets in microseconds, applied only
+	// when the kernel provides the io.latency file
+	DeviceLatency map[IODevice]uint64
+}
+
+// IOStat holds the io.stat counters of a device.
+type IOStat struct {
+	Device IODevice
+	RBytes uint64
+	WBytes uint64
+	RIOs   uint64
+	WIOs   uint64
+	DBytes uint64
+	DIOs   uint64
+}
+
+func (i *IOSubSystem) Name() string {
+	return "io"
+}
+
+// Apply applies io subsystem limits.
+func (i *IOSubSystem) Apply(fs FileSystem, path string) error {
+	var files []CgroupFile
+	if i.Weight != nil {
+		files = append(files, CgroupFile{"io.weight", "default " + strconv.FormatUint(*i.Weight, 10)})
+	}
+	for _, dev := range sortedDevices(i.DeviceWeights) {
+		files = append(files, CgroupFile{"io.weight", fmt.Sprintf("%s %d", dev, i.DeviceWeights[dev])})
+	}
+	for _, dev := range sortedDevices(i.DeviceLimits) {
+		if line := i.DeviceLimits[dev].format(); line != "" {
+			files = append(files, CgroupFile{"io.max", dev.String() + " " + line})
+		}
+	}
+	if len(i.DeviceLatency) > 0 {
+		if _, err := fs.Stat(filepath.Join(path, "io.latency")); err == nil {
+			for _, dev := range sortedDevices(i.DeviceLatency) {
+				files = append(files, CgroupFile{"io.latency", fmt.Sprintf("%s target=%d", dev, i.DeviceLatency[dev])})
+			}
+		}
+	}
+
+	// Each line of io.weight, io.max and io.latency configures one device,
+	// so every line is written separately.
+	for _, f := range files {
+		if err := writeCgroupFile(fs, path, f.Filename, f.Value); err != nil {
+			return fmt.Errorf("io subsystem: failed to set %s: %w", f.Filename, err)
+		}
+	}
+	return nil
+}
+
+// Stat parses the per-device counters of io.stat.
+func (i *IOSubSystem) Stat(fs FileSystem, path string, stats *Stats) error {
+	ioStats, err := parseIOStat(fs, path)
+	if err != nil {
+		return err
+	}
+	stats.IO = ioStats
+	return nil
+}
+
+func parseIOStat(fs FileSystem, path string) ([]IOStat, error) {
+	content, err := fs.ReadFile(filepath.Join(path, "io.stat"))
+	if err != nil {
+		return nil, fmt.Errorf("io subsystem: failed to read io.stat: %w", err)
+	}
+
+	var stats []IOStat
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var stat IOStat
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &stat.Device.Major, &stat.Device.Minor); err != nil {
+			return nil, fmt.Errorf("io subsystem: invalid device %q in io.stat: %w", fields[0], err)
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("io subsystem: invalid value %q in io.stat: %w", field, err)
+			}
+			switch key {
+			case "rbytes":
+				stat.RBytes = n
+			case "wbytes":
+				stat.WBytes = n
+			case "rios":
+				stat.RIOs = n
+			case "wios":
+				stat.WIOs = n
+			case "dbytes":
+				stat.DBytes = n
+			case "dios":
+				stat.DIOs = n
+			}
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+func (l IOLimit) format() string {
+	limits := []struct {
+		key   string
+		value *uint64
+	}{
+		{"rbps", l.RBps},
+		{"wbps", l.WBps},
+		{"riops", l.RIOps},
+		{"wiops", l.WIOps},
+	}
+
+	var parts []string
+	for _, limit := range limits {
+		if limit.value == nil {
+			continue
+		}
+		value := "max"
+		if *limit.value != 0 {
+			value = strconv.FormatUint(*limit.value, 10)
+		}
+		parts = append(parts, limit.key+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
+
+func sortedDevices[V any](m map[IODevice]V) []IODevice {
+	devices := make([]IODevice, 0, len(m))
+	for dev := range m {
+		devices = append(devices, dev)
+	}
+	sort.Slice(devices, func(a, b int) bool {
+		if devices[a].Major != devices[b].Major {
+			return devices[a].Major < devices[b].Major
+		}
+		return devices[a].Minor < devices[b].Minor
+	})
+	return devices
+}
@@ -0,0 +1,151 @@
+package cgroup
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+// newIOCgroup creates the cgroup /ctr with the io controller enabled in a fake
+// cgroup filesystem.
+func newIOCgroup(t *testing.T) *fakeCgroupFS {
+	t.Helper()
+	fs := newFakeCgroupFS(t, "io")
+	if err := writeCgroupFile(fs, fs.root, "cgroup.subtree_control", "+io"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.MkdirAll(fs.root + "/ctr"); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestIOSubSystemDeviceLimits(t *testing.T) {
+	rate, zero := uint64(1<<20), uint64(0)
+	sda, sdb, nvme := IODevice{8, 0}, IODevice{8, 16}, IODevice{259, 0}
+
+	tests := []struct {
+		name   string
+		before string
+		limits map[IODevice]IOLimit
+		want   string
+	}{
+		{
+			name:   "unset limits read as max",
+			limits: map[IODevice]IOLimit{sda: {RBps: &rate}},
+			want:   "8:0 rbps=1048576 wbps=max riops=max wiops=max",
+		},
+		{
+			name:   "limits of a device are merged into one line",
+			limits: map[IODevice]IOLimit{sda: {RBps: &rate, WBps: &rate, RIOps: &rate, WIOps: &rate}},
+			want:   "8:0 rbps=1048576 wbps=1048576 riops=1048576 wiops=1048576",
+		},
+		{
+			name:   "every device has its own line",
+			limits: map[IODevice]IOLimit{nvme: {WIOps: &rate}, sda: {RBps: &rate}, sdb: {WBps: &rate}},
+			want: "8:0 rbps=1048576 wbps=max riops=max wiops=max\n" +
+				"8:16 rbps=max wbps=1048576 riops=max wiops=max\n" +
+				"259:0 rbps=max wbps=max riops=max wiops=1048576",
+		},
+		{
+			name:   "limits that are not set keep their value",
+			before: "8:0 rbps=100 wbps=max riops=max wiops=max\n",
+			limits: map[IODevice]IOLimit{sda: {WIOps: &rate}},
+			want:   "8:0 rbps=100 wbps=max riops=max wiops=1048576",
+		},
+		{
+			name:   "zero removes a limit",
+			before: "8:0 rbps=100 wbps=200 riops=max wiops=max\n",
+			limits: map[IODevice]IOLimit{sda: {RBps: &zero}},
+			want:   "8:0 rbps=max wbps=200 riops=max wiops=max",
+		},
+		{
+			name:   "a device without limits is not listed",
+			before: "8:0 rbps=100 wbps=max riops=max wiops=max\n8:16 rbps=1 wbps=max riops=max wiops=max\n",
+			limits: map[IODevice]IOLimit{sda: {RBps: &zero}},
+			want:   "8:16 rbps=1 wbps=max riops=max wiops=max",
+		},
+		{
+			name:   "a device without set limits is not written",
+			before: "8:0 rbps=100 wbps=max riops=max wiops=max\n",
+			limits: map[IODevice]IOLimit{sda: {}},
+			want:   "8:0 rbps=100 wbps=max riops=max wiops=max",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newIOCgroup(t)
+			fs.set(t, "/ctr", "io.max", tt.before)
+
+			i := &IOSubSystem{DeviceLimits: tt.limits}
+			if err := i.Apply(fs, fs.root+"/ctr"); err != nil {
+				t.Fatal(err)
+			}
+			if got := fs.read(t, "/ctr", "io.max"); got != tt.want {
+				t.Errorf("io.max = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIOSubSystemWeights(t *testing.T) {
+	weight, low, high, invalid := uint64(300), uint64(50), uint64(10000), uint64(0)
+	sda, sdb := IODevice{8, 0}, IODevice{8, 16}
+
+	tests := []struct {
+		name    string
+		weight  *uint64
+		devices map[IODevice]uint64
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "default weight",
+			weight: &weight,
+			want:   "default 300",
+		},
+		{
+			name:    "device weights keep the default",
+			devices: map[IODevice]uint64{sdb: high, sda: low},
+			want:    "default 100\n8:0 50\n8:16 10000",
+		},
+		{
+			name:    "default and device weights",
+			weight:  &weight,
+			devices: map[IODevice]uint64{sda: low},
+			want:    "default 300\n8:0 50",
+		},
+		{
+			name:    "default weight out of range",
+			weight:  &invalid,
+			wantErr: syscall.EINVAL,
+		},
+		{
+			name:    "device weight out of range",
+			devices: map[IODevice]uint64{sda: invalid},
+			wantErr: syscall.EINVAL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newIOCgroup(t)
+
+			i := &IOSubSystem{Weight: tt.weight, DeviceWeights: tt.devices}
+			err := i.Apply(fs, fs.root+"/ctr")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Apply() = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fs.read(t, "/ctr", "io.weight"); got != tt.want {
+				t.Errorf("io.weight = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// killTimeout bounds how long killCgroup waits for the cgroup to empty.
+	killTimeout = 10 * time.Second
+	// freezeTimeout bounds how long the fallback waits for the cgroup to freeze.
+	freezeTimeout = 5 * time.Second
+	// removeRetries is how often an rmdir failing with EBUSY is retried, as a
+	// cgroup can stay busy for a moment after its last process exited.
+	removeRetries = 10
+)
+
+// killCgroup kills every process in the cgroup at path, including those in
+// descendant cgroups, and waits until the cgroup is no longer populated.
+// It uses cgroup.kill where available, and otherwise freezes the cgroup and
+// signals each process so that none can fork in the meantime.
+func killCgroup(fs FileSystem, path string) error {
+	if _, err := fs.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if _, err := fs.Stat(filepath.Join(path, "cgroup.kill")); err == nil {
+		if err := writeCgroupFile(fs, path, "cgroup.kill", "1"); err != nil {
+			return fmt.Errorf("cgroup: failed to kill processes: %w", err)
+		}
+	} else if err := freezeAndKill(fs, path); err != nil {
+		return err
+	}
+
+	err := waitCgroupEvents(fs, path, killTimeout, func(events map[string]uint64) bool {
+		return events["populated"] == 0
+	})
+	if err != nil {
+		return fmt.Errorf("cgroup: processes did not exit: %w", err)
+	}
+	return nil
+}
+
+// freezeAndKill is the fallback for kernels without cgroup.kill (before 5.14).
+func freezeAndKill(fs FileSystem, path string) error {
+	if err := writeCgroupFile(fs, path, "cgroup.freeze", "1"); err != nil {
+		return fmt.Errorf("cgroup: failed to freeze cgroup: %w", err)
+	}
+	// Thawing lets the killed processes run their exit path.
+	defer func() { _ = writeCgroupFile(fs, path, "cgroup.freeze", "0") }()
+
+	err := waitCgroupEvents(fs, path, freezeTimeout, func(events map[string]uint64) bool {
+		return events["frozen"] == 1
+	})
+	if err != nil {
+		return fmt.Errorf("cgroup: cgroup did not freeze: %w", err)
+	}
+
+	pids, err := cgroupProcs(fs, path)
+	if err != nil {
+		return err
+	}
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("cgroup: failed to kill process %d: %w", pid, err)
+		}
+	}
+	return nil
+}
+
+// cgroupProcs returns the processes in the cgroup at path and its descendants.
+func cgroupProcs(fs FileSystem, path string) ([]int, error) {
+	content, err := readCgroupFile(fs, path, "cgroup.procs")
+	if err != nil {
+		return nil, fmt.Errorf("cgroup: failed to list processes: %w", err)
+	}
+	var pids []int
+	for _, field := range strings.Fields(content) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("cgroup: invalid pid %q in %s/cgroup.procs", field, path)
+		}
+		pids = append(pids, pid)
+	}
+
+	entries, err := fs.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("cgroup: failed to list processes: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		children, err := cgroupProcs(fs, filepath.Join(path, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		pids = append(pids, children...)
+	}
+	return pids, nil
+}
+
+// RemoveTree removes the cgroup at path and every cgroup below it,
+// deepest first. The interface files inside need not, and cannot, be removed.
+// It serves the cgroup v1 hierarchies as well.
+func RemoveTree(path string) error {
+	entries, err := os.ReadDir(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cgroup: failed to read cgroup %s: %w", path, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if err := RemoveTree(filepath.Join(path, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := 0; ; i++ {
+		err := syscall.Rmdir(path)
+		if err == nil || errors.Is(err, syscall.ENOENT) {
+			return nil
+		}
+		if !errors.Is(err, syscall.EBUSY) || i == removeRetries {
+			return fmt.Errorf("cgroup: failed to remove cgroup %s: %w", path, err)
+		}
+		time.Sleep(time.Duration(i+1) * 10 * time.Millisecond)
+	}
+}
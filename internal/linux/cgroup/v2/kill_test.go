@@ -0,0 +1,72 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKillCgroupWaitsUntilUnpopulated(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"cgroup.kill":   "",
+		"cgroup.events": "populated 1\nfrozen 0\n",
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- killCgroup(OSFileSystem{}, dir) }()
+
+	// Emulate the kernel: once cgroup.kill is written, the cgroup empties.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		content, err := os.ReadFile(filepath.Join(dir, "cgroup.kill"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) == "1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cgroup.kill was not written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("killCgroup returned before the cgroup was empty: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	writeFiles(t, dir, map[string]string{"cgroup.events": "populated 0\nfrozen 0\n"})
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("killCgroup failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("killCgroup did not notice that the cgroup became empty")
+	}
+}
+
+func TestRemoveCgroupTree(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "abc")
+	if err := os.MkdirAll(filepath.Join(dir, "sub", "leaf"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "other"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RemoveTree(dir); err != nil {
+		t.Fatalf("RemoveTree failed: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("cgroup %s still exists", dir)
+	}
+	if err := RemoveTree(dir); err != nil {
+		t.Errorf("RemoveTree of a missing cgroup failed: %v", err)
+	}
+}
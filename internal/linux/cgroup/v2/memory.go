@@ -6,30 +6,27 @@ import (
 )
 
 // MemorySubSystem defines configurable memory limits.
+// A nil field leaves the corresponding file at its kernel default; -1 means "max".
 type MemorySubSystem struct {
-	Min            int64
-	Low            int64
-	High           int64
-	Max            int64
-	Peak           int64
-	OOMGroup       int64
-	SwapHigh       int64
-	SwapPeak       int64
-	SwapMax        int64
-	ZswapMax       int64
-	ZswapWriteback int64
+	Min            *int64
+	Low            *int64
+	High           *int64
+	Max            *int64
+	OOMGroup       *int64
+	SwapHigh       *int64
+	SwapMax        *int64
+	ZswapMax       *int64
+	ZswapWriteback *int64
 }
 
-func NewMemorySubSystem(minVal, low, high, maxVal, peak, oomGroup, swapHigh, swapPeak, swapMax, zswapMax, zswapWriteback int64) *MemorySubSystem {
+func NewMemorySubSystem(minVal, low, high, maxVal, oomGroup, swapHigh, swapMax, zswapMax, zswapWriteback *int64) *MemorySubSystem {
 	return &MemorySubSystem{
 		Min:            minVal,
 		Low:            low,
 		High:           high,
 		Max:            maxVal,
-		Peak:           peak,
 		OOMGroup:       oomGroup,
 		SwapHigh:       swapHigh,
-		SwapPeak:       swapPeak,
 		SwapMax:        swapMax,
 		ZswapMax:       zswapMax,
 		ZswapWriteback: zswapWriteback,
@@ -40,26 +37,78 @@ func (m *MemorySubSystem) Name() string {
 	return "memory"
 }
 
-// Setup applies memory subsystem limits.
-func (m *MemorySubSystem) Setup(path string) error {
-	files := []CgroupFile{
-		{"memory.min", strconv.FormatInt(m.Min, 10)},
-		{"memory.low", strconv.FormatInt(m.Low, 10)},
-		{"memory.high", strconv.FormatInt(m.High, 10)},
-		{"memory.max", strconv.FormatInt(m.Max, 10)},
-		{"memory.peak", strconv.FormatInt(m.Peak, 10)},
-		{"memory.oom.group", strconv.FormatInt(m.OOMGroup, 10)},
-		{"memory.swap.high", strconv.FormatInt(m.SwapHigh, 10)},
-		{"memory.swap.peak", strconv.FormatInt(m.SwapPeak, 10)},
-		{"memory.swap.max", strconv.FormatInt(m.SwapMax, 10)},
-		{"memory.zswap.max", strconv.FormatInt(m.ZswapMax, 10)},
-		{"memory.zswap.writeback", strconv.FormatInt(m.ZswapWriteback, 10)},
+// Apply applies memory subsystem limits.
+func (m *MemorySubSystem) Apply(fs FileSystem, path string) error {
+	limits := []struct {
+		filename string
+		value    *int64
+	}{
+		{"memory.min", m.Min},
+		{"memory.low", m.Low},
+		{"memory.high", m.High},
+		{"memory.max", m.Max},
+		{"memory.swap.high", m.SwapHigh},
+		{"memory.swap.max", m.SwapMax},
+		{"memory.zswap.max", m.ZswapMax},
+	}
+
+	var files []CgroupFile
+	for _, l := range limits {
+		if l.value != nil {
+			files = append(files, CgroupFile{l.filename, formatLimit(*l.value)})
+		}
+	}
+	if m.OOMGroup != nil {
+		files = append(files, CgroupFile{"memory.oom.group", strconv.FormatInt(*m.OOMGroup, 10)})
+	}
+	if m.ZswapWriteback != nil {
+		files = append(files, CgroupFile{"memory.zswap.writeback", strconv.FormatInt(*m.ZswapWriteback, 10)})
 	}
 
 	for _, f := range files {
-		if err := writeCgroupFile(path, f.Filename, f.Value); err != nil {
+		if err := writeCgroupFile(fs, path, f.Filename, f.Value); err != nil {
 			return fmt.Errorf("memory subsystem: failed to set %s: %w", f.Filename, err)
 		}
 	}
 	return nil
 }
+
+// Stat reads memory usage, peaks, events and the memory.stat breakdown.
+func (m *MemorySubSystem) Stat(fs FileSystem, path string, stats *Stats) error {
+	memStats := &MemoryStats{}
+	counters := []struct {
+		filename string
+		value    *uint64
+	}{
+		{"memory.current", &memStats.Current},
+		{"memory.peak", &memStats.Peak},
+		{"memory.swap.current", &memStats.SwapCurrent},
+		{"memory.swap.peak", &memStats.SwapPeak},
+	}
+	for _, c := range counters {
+		if err := readUint(fs, path, c.filename, c.value); err != nil {
+			return fmt.Errorf("memory subsystem: %w", err)
+		}
+	}
+
+	events, err := readKeyValues(fs, path, "memory.events")
+	if err != nil {
+		return fmt.Errorf("memory subsystem: %w", err)
+	}
+	memStats.Events = MemoryEvents{
+		Low:          events["low"],
+		High:         events["high"],
+		Max:          events["max"],
+		OOM:          events["oom"],
+		OOMKill:      events["oom_kill"],
+		OOMGroupKill: events["oom_group_kill"],
+	}
+
+	memStats.Stat, err = readKeyValues(fs, path, "memory.stat")
+	if err != nil {
+		return fmt.Errorf("memory subsystem: %w", err)
+	}
+
+	stats.Memory = memStats
+	return nil
+}
@@ -0,0 +1,131 @@
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MiscSubSystem limits the scalar resources of the misc controller, such as
+// the "sev" and "sev_es" ASIDs of AMD SEV.
+type MiscSubSystem struct {
+	// misc.max: per-resource limits; -1 means 'max' (unlimited)
+	Max map[string]int64
+}
+
+func (m *MiscSubSystem) Name() string {
+	return "misc"
+}
+
+// Apply applies the misc resource limits. The kernel takes a single resource
+// per write to misc.max. Resources the host has no capacity for, as listed in
+// the root cgroup's misc.capacity, are skipped with a warning.
+func (m *MiscSubSystem) Apply(fs FileSystem, path string) error {
+	resources := make([]string, 0, len(m.Max))
+	for resource := range m.Max {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	if len(resources) == 0 {
+		return nil
+	}
+
+	capacity, err := miscCapacity(fs, path)
+	if err != nil {
+		return fmt.Errorf("misc subsystem: %w", err)
+	}
+	for _, resource := range resources {
+		if _, ok := capacity[resource]; !ok {
+			log.Printf("cgroup: warning: skipping misc.max for %s: the host has no %s capacity", resource, resource)
+			continue
+		}
+		value := resource + " " + formatLimit(m.Max[resource])
+		if err := writeCgroupFile(fs, path, "misc.max", value); err != nil {
+			return fmt.Errorf("misc subsystem: failed to set misc.max to %q: %w", value, err)
+		}
+	}
+	return nil
+}
+
+// Stat reads the usage, capacity and limit hits of every misc resource.
+func (m *MiscSubSystem) Stat(fs FileSystem, path string, stats *Stats) error {
+	current, err := readKeyValues(fs, path, "misc.current")
+	if err != nil {
+		return fmt.Errorf("misc subsystem: %w", err)
+	}
+	events, err := readKeyValues(fs, path, "misc.events")
+	if err != nil {
+		return fmt.Errorf("misc subsystem: %w", err)
+	}
+	capacity, err := miscCapacity(fs, path)
+	if err != nil {
+		return fmt.Errorf("misc subsystem: %w", err)
+	}
+
+	stats.Misc = make(map[string]MiscStats)
+	for resource, value := range capacity {
+		stats.Misc[resource] = MiscStats{
+			Current:   current[resource],
+			Capacity:  value,
+			MaxEvents: events[resource+".max"],
+		}
+	}
+	return nil
+}
+
+// miscCapacity reads the misc resources of the host from the misc.capacity
+// file, which only the root cgroup has. The cgroup at path and its ancestors
+// are searched up to the root of the cgroup filesystem. A host without misc
+// resources has no capacity.
+func miscCapacity(fs FileSystem, path string) (map[string]uint64, error) {
+	for dir := path; ; dir = filepath.Dir(dir) {
+		_, err := fs.Stat(filepath.Join(dir, "misc.capacity"))
+		if err == nil {
+			return readKeyValues(fs, dir, "misc.capacity")
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		// Only cgroups have cgroup.controllers, so its absence marks the
+		// directory above the root of the cgroup filesystem.
+		_, err = fs.Stat(filepath.Join(dir, "cgroup.controllers"))
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]uint64{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if dir == filepath.Dir(dir) {
+			return map[string]uint64{}, nil
+		}
+	}
+}
+
+// ParseMiscMax parses a misc.max value, one "<resource> <limit>" line per
+// resource, as given in linux.resources.unified.
+func ParseMiscMax(value string) (map[string]int64, error) {
+	limits := make(map[string]int64)
+	for _, line := range strings.Split(value, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("cgroup: misc.max line %q must have the form <resource> <limit>", line)
+		}
+		limit := int64(-1)
+		if fields[1] != "max" {
+			var err error
+			if limit, err = strconv.ParseInt(fields[1], 10, 64); err != nil || limit < 0 {
+				return nil, fmt.Errorf("cgroup: invalid misc.max limit %q for %s", fields[1], fields[0])
+			}
+		}
+		limits[fields[0]] = limit
+	}
+	return limits, nil
+}
@@ -0,0 +1,98 @@
+package cgroup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMiscSubSystem(t *testing.T) {
+	fs := newFakeCgroupFS(t, "misc")
+	fs.set(t, "/", "misc.capacity", "sev 509\nsev_es 0\n")
+
+	m := NewCgroupManager("/ctr", []SubSystem{
+		// The host has no tdx capacity, so its limit is skipped.
+		&MiscSubSystem{Max: map[string]int64{"sev": 10, "tdx": 4}},
+	})
+	m.SetRoot(fs.root)
+	m.SetFileSystem(fs)
+	if err := m.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.read(t, "/ctr", "misc.max"); got != "sev 10" {
+		t.Errorf("misc.max = %q, want %q", got, "sev 10")
+	}
+
+	fs.set(t, "/ctr", "misc.current", "sev 2\nsev_es 0\n")
+	fs.set(t, "/ctr", "misc.events", "sev.max 1\nsev_es.max 0\n")
+	stats, err := m.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]MiscStats{
+		"sev":    {Current: 2, Capacity: 509, MaxEvents: 1},
+		"sev_es": {},
+	}
+	if !reflect.DeepEqual(stats.Misc, want) {
+		t.Errorf("misc stats = %+v, want %+v", stats.Misc, want)
+	}
+}
+
+func TestMiscSubSystemWithoutCapacity(t *testing.T) {
+	fs := newFakeCgroupFS(t, "misc")
+
+	m := NewCgroupManager("/ctr", []SubSystem{&MiscSubSystem{Max: map[string]int64{"sev": 10}}})
+	m.SetRoot(fs.root)
+	m.SetFileSystem(fs)
+	if err := m.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.read(t, "/ctr", "misc.max"); got != "" {
+		t.Errorf("misc.max = %q, want it untouched", got)
+	}
+	stats, err := m.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Misc) != 0 {
+		t.Errorf("misc stats = %+v, want none", stats.Misc)
+	}
+}
+
+func TestMiscCapacity(t *testing.T) {
+	fs := newFakeCgroupFS(t, "misc")
+	fs.set(t, "/", "misc.capacity", "sev 509\n")
+	if err := fs.MkdirAll(fs.root + "/a/b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the root cgroup has misc.capacity, so it is found from below.
+	got, err := miscCapacity(fs, fs.root+"/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]uint64{"sev": 509}; !reflect.DeepEqual(got, want) {
+		t.Errorf("miscCapacity() = %v, want %v", got, want)
+	}
+
+	// A path through a file fails with ENOTDIR instead of meaning "no capacity".
+	fs.set(t, "/a", "file", "")
+	if got, err := miscCapacity(fs, fs.root+"/a/file/c"); err == nil {
+		t.Errorf("miscCapacity() below a file = %v, want error", got)
+	}
+}
+
+func TestParseMiscMax(t *testing.T) {
+	got, err := ParseMiscMax("sev 10\nsev_es max\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int64{"sev": 10, "sev_es": -1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseMiscMax = %v, want %v", got, want)
+	}
+
+	for _, value := range []string{"sev", "sev -1", "sev ten", "sev 1 2"} {
+		if _, err := ParseMiscMax(value); err == nil {
+			t.Errorf("ParseMiscMax(%q) succeeded, want error", value)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package cgroup
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+)
+
+// Mode is the layout of the cgroup filesystem on a host.
+type Mode int
+
+const (
+	// Unified is a pure cgroup v2 hierarchy.
+	Unified Mode = iota
+	// Hybrid has cgroup v1 hierarchies for the controllers and a cgroup v2
+	// hierarchy without controllers at /sys/fs/cgroup/unified.
+	Hybrid
+	// Legacy has only cgroup v1 hierarchies.
+	Legacy
+)
+
+// Filesystem magic numbers from linux/magic.h.
+const (
+	cgroup2SuperMagic = 0x63677270
+	tmpfsMagic        = 0x01021994
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Unified:
+		return "unified"
+	case Hybrid:
+		return "hybrid"
+	case Legacy:
+		return "legacy"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// DetectMode detects the cgroup mode of the host from the filesystem mounted
+// at /sys/fs/cgroup.
+func DetectMode() (Mode, error) {
+	return detectMode(DefaultRoot)
+}
+
+func detectMode(root string) (Mode, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(root, &st); err != nil {
+		return 0, fmt.Errorf("cgroup: failed to stat %s: %w", root, err)
+	}
+	switch int64(st.Type) {
+	case cgroup2SuperMagic:
+		return Unified, nil
+	case tmpfsMagic:
+		// The v1 hierarchies are mounted on a tmpfs.
+	default:
+		return 0, fmt.Errorf("cgroup: %s is not a cgroup filesystem (magic %#x)", root, st.Type)
+	}
+
+	if err := syscall.Statfs(filepath.Join(root, "unified"), &st); err == nil && int64(st.Type) == cgroup2SuperMagic {
+		return Hybrid, nil
+	}
+	return Legacy, nil
+}
@@ -1,39 +1,48 @@
 package cgroup
 
-import (
-	"fmt"
-	"strconv"
-)
+import "fmt"
 
+// PidsSubSystem defines the process number limit. A nil limit leaves pids.max
+// at its kernel default; -1 means "max".
 type PidsSubSystem struct {
-	MaxPids     int64
-	Current     int64
-	Peak        int64
-	Events      int64
-	EventsLocal int64
+	MaxPids *int64
 }
 
 func NewPidsSubSystem(maxPids int64) *PidsSubSystem {
-	return &PidsSubSystem{MaxPids: maxPids}
+	return &PidsSubSystem{MaxPids: &maxPids}
 }
 
 func (p *PidsSubSystem) Name() string {
 	return "pids"
 }
 
-func (p *PidsSubSystem) Setup(path string) error {
-	files := []CgroupFile{
-		{"pids.max", strconv.FormatInt(p.MaxPids, 10)},
-		{"pids.current", strconv.FormatInt(p.Current, 10)},
-		{"pids.peak", strconv.FormatInt(p.Peak, 10)},
-		{"pids.events", strconv.FormatInt(p.Events, 10)},
-		{"pids.events.local", strconv.FormatInt(p.EventsLocal, 10)},
+// Apply applies the pids limit.
+func (p *PidsSubSystem) Apply(fs FileSystem, path string) error {
+	if p.MaxPids == nil {
+		return nil
 	}
+	if err := writeCgroupFile(fs, path, "pids.max", formatLimit(*p.MaxPids)); err != nil {
+		return fmt.Errorf("pids subsystem: failed to set pids.max: %w", err)
+	}
+	return nil
+}
 
-	for _, f := range files {
-		if err := writeCgroupFile(path, f.Filename, f.Value); err != nil {
-			return fmt.Errorf("pids subsystem: failed to set %s: %w", f.Filename, err)
-		}
+// Stat reads the current and peak process counts and the pids.max events.
+func (p *PidsSubSystem) Stat(fs FileSystem, path string, stats *Stats) error {
+	pidsStats := &PidsStats{}
+	if err := readUint(fs, path, "pids.current", &pidsStats.Current); err != nil {
+		return fmt.Errorf("pids subsystem: %w", err)
+	}
+	if err := readUint(fs, path, "pids.peak", &pidsStats.Peak); err != nil {
+		return fmt.Errorf("pids subsystem: %w", err)
 	}
+
+	events, err := readKeyValues(fs, path, "pids.events")
+	if err != nil {
+		return fmt.Errorf("pids subsystem: %w", err)
+	}
+	pidsStats.MaxEvents = events["max"]
+
+	stats.Pids = pidsStats
 	return nil
 }
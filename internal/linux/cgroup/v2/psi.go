@@ -0,0 +1,197 @@
+package cgroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// PressureResources lists the resources with pressure stall information (PSI).
+var PressureResources = []string{"cpu", "memory", "io"}
+
+// PressureStall represents pressure stall information (PSI) for a specific resource.
+type PressureStall struct {
+	Avg10  float64 // Average over last 10 seconds
+	Avg60  float64 // Average over last 60 seconds
+	Avg300 float64 // Average over last 300 seconds (5 minutes)
+	Total  uint64  // Accumulated time (microseconds)
+}
+
+// Pressure represents pressure stall information (PSI) from a cpu.pressure,
+// memory.pressure or io.pressure file.
+type Pressure struct {
+	Some PressureStall // Some tasks were stalled on the resource
+	Full PressureStall // All non-idle tasks were stalled on the resource at once
+}
+
+// ReadPressure reads the pressure stall information of a resource ("cpu",
+// "memory" or "io") in the cgroup at path.
+func ReadPressure(path, resource string) (*Pressure, error) {
+	if !slices.Contains(PressureResources, resource) {
+		return nil, fmt.Errorf("cgroup: no pressure stall information for %q", resource)
+	}
+	filename := resource + ".pressure"
+	content, err := readCgroupFile(OSFileSystem{}, path, filename)
+	if err != nil {
+		return nil, fmt.Errorf("cgroup: failed to read %s: %w", filename, err)
+	}
+	pressure, err := parsePressure(content)
+	if err != nil {
+		return nil, fmt.Errorf("cgroup: failed to parse %s: %w", filename, err)
+	}
+	return pressure, nil
+}
+
+// parsePressure parses lines such as
+// "some avg10=0.12 avg60=0.05 avg300=0.01 total=123456".
+func parsePressure(content string) (*Pressure, error) {
+	pressure := &Pressure{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var stall *PressureStall
+		switch fields[0] {
+		case "some":
+			stall = &pressure.Some
+		case "full":
+			stall = &pressure.Full
+		default:
+			return nil, fmt.Errorf("unknown line %q", line)
+		}
+
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid field %q", field)
+			}
+			var err error
+			switch key {
+			case "avg10":
+				stall.Avg10, err = strconv.ParseFloat(value, 64)
+			case "avg60":
+				stall.Avg60, err = strconv.ParseFloat(value, 64)
+			case "avg300":
+				stall.Avg300, err = strconv.ParseFloat(value, 64)
+			case "total":
+				stall.Total, err = strconv.ParseUint(value, 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid field %q: %w", field, err)
+			}
+		}
+	}
+	return pressure, nil
+}
+
+// PressureTrigger is a PSI threshold: it fires when tasks were stalled on
+// Resource for at least Stall within any Window, such as 150ms in 1s.
+type PressureTrigger struct {
+	Resource string // "cpu", "memory" or "io"
+	Kind     string // "some" or "full"
+	Stall    time.Duration
+	Window   time.Duration
+}
+
+// PressureEvent reports that a PressureTrigger fired.
+type PressureEvent struct {
+	Trigger PressureTrigger
+	Time    time.Time
+}
+
+// The kernel's limits for PSI trigger windows.
+const (
+	minPressureWindow = 500 * time.Millisecond
+	maxPressureWindow = 10 * time.Second
+)
+
+func (t PressureTrigger) validate() error {
+	if !slices.Contains(PressureResources, t.Resource) {
+		return fmt.Errorf("cgroup: no pressure stall information for %q", t.Resource)
+	}
+	if t.Kind != "some" && t.Kind != "full" {
+		return fmt.Errorf("cgroup: pressure trigger kind %q must be some or full", t.Kind)
+	}
+	if t.Window < minPressureWindow || t.Window > maxPressureWindow {
+		return fmt.Errorf("cgroup: pressure trigger window %s must be between %s and %s", t.Window, minPressureWindow, maxPressureWindow)
+	}
+	if t.Stall <= 0 || t.Stall > t.Window {
+		return fmt.Errorf("cgroup: pressure trigger stall %s must be positive and at most the window %s", t.Stall, t.Window)
+	}
+	return nil
+}
+
+// String returns the trigger in the form written to the pressure file, such
+// as "some 150000 1000000" (microseconds).
+func (t PressureTrigger) String() string {
+	return fmt.Sprintf("%s %d %d", t.Kind, t.Stall.Microseconds(), t.Window.Microseconds())
+}
+
+// WatchPressure registers a trigger with the cgroup at path and delivers an
+// event on the returned channel every time it fires. The kernel reports a
+// trigger at most once per window. The channel is closed once ctx is done or
+// the cgroup is removed.
+func WatchPressure(ctx context.Context, path string, trigger PressureTrigger) (<-chan PressureEvent, error) {
+	if err := trigger.validate(); err != nil {
+		return nil, err
+	}
+
+	// The trigger lives as long as the file stays open.
+	filename := trigger.Resource + ".pressure"
+	f, err := os.OpenFile(filepath.Join(path, filename), os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cgroup: failed to open %s: %w", filename, err)
+	}
+	if _, err := f.WriteString(trigger.String()); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cgroup: failed to register pressure trigger %q: %w", trigger, err)
+	}
+
+	epollFd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cgroup: failed to create epoll instance: %w", err)
+	}
+	fd := int(f.Fd())
+	event := syscall.EpollEvent{Events: syscall.EPOLLPRI, Fd: int32(fd)}
+	if err := syscall.EpollCtl(epollFd, syscall.EPOLL_CTL_ADD, fd, &event); err != nil {
+		syscall.Close(epollFd)
+		f.Close()
+		return nil, fmt.Errorf("cgroup: failed to poll %s: %w", filename, err)
+	}
+
+	events := make(chan PressureEvent, 1)
+	go func() {
+		defer close(events)
+		defer f.Close()
+		defer syscall.Close(epollFd)
+
+		ready := make([]syscall.EpollEvent, 1)
+		for ctx.Err() == nil {
+			n, err := syscall.EpollWait(epollFd, ready, int(watchInterval.Milliseconds()))
+			if errors.Is(err, syscall.EINTR) || n == 0 {
+				continue
+			}
+			if err != nil || ready[0].Events&syscall.EPOLLERR != 0 {
+				// The cgroup, and with it the trigger, is gone.
+				return
+			}
+
+			select {
+			case events <- PressureEvent{Trigger: trigger, Time: time.Now()}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,53 @@
+package cgroup
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadPressure(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"memory.pressure": "some avg10=1.50 avg60=0.75 avg300=0.10 total=123456\nfull avg10=0.50 avg60=0.00 avg300=0.00 total=4567\n",
+	})
+
+	got, err := ReadPressure(dir, "memory")
+	if err != nil {
+		t.Fatalf("ReadPressure failed: %v", err)
+	}
+	want := &Pressure{
+		Some: PressureStall{Avg10: 1.5, Avg60: 0.75, Avg300: 0.1, Total: 123456},
+		Full: PressureStall{Avg10: 0.5, Total: 4567},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadPressure = %+v, want %+v", got, want)
+	}
+
+	if _, err := ReadPressure(dir, "pids"); err == nil {
+		t.Error("ReadPressure of pids succeeded, want error")
+	}
+}
+
+func TestPressureTrigger(t *testing.T) {
+	trigger := PressureTrigger{Resource: "memory", Kind: "some", Stall: 150 * time.Millisecond, Window: time.Second}
+	if err := trigger.validate(); err != nil {
+		t.Errorf("validate(%v) failed: %v", trigger, err)
+	}
+	if got, want := trigger.String(), "some 150000 1000000"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	invalid := []PressureTrigger{
+		{Resource: "pids", Kind: "some", Stall: time.Millisecond, Window: time.Second},
+		{Resource: "io", Kind: "most", Stall: time.Millisecond, Window: time.Second},
+		{Resource: "cpu", Kind: "full", Stall: time.Millisecond, Window: 100 * time.Millisecond},
+		{Resource: "cpu", Kind: "full", Stall: 2 * time.Second, Window: time.Second},
+	}
+	for _, trigger := range invalid {
+		if _, err := WatchPressure(context.Background(), t.TempDir(), trigger); err == nil {
+			t.Errorf("WatchPressure(%+v) succeeded, want error", trigger)
+		}
+	}
+}
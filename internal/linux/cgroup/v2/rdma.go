@@ -1,31 +1,106 @@
 package cgroup
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
 
+// RDMASubsystem defines the RDMA limits of every device.
 type RDMASubsystem struct {
-	Max     RDMAHCA
-	Current RDMAHCA
+	Limits map[string]RDMALimit // map of device name, such as "mlx5_0", to its limits
 }
 
+// RDMALimit holds the limits of one RDMA device. A nil field is unlimited.
+type RDMALimit struct {
+	HCAHandles *uint32
+	HCAObjects *uint32
+}
+
+// RDMAHCA holds the usage of one RDMA device.
 type RDMAHCA struct {
 	HCAHandle int64
 	HCAObject int64
 }
 
 func (n *RDMASubsystem) Name() string {
-	return "RDMA"
+	return "rdma"
 }
 
-// Setup applies RDMA subsystem limits.
-func (n *RDMASubsystem) Setup(path string) error {
-	cgroupFiles := []CgroupFile{
-		{"rdma.max", fmt.Sprintf("hca_handle=%d hca_object=%d", n.Max.HCAHandle, n.Max.HCAObject)},
-		{"rdma.current", fmt.Sprintf("hca_handle=%d hca_object=%d", n.Current.HCAHandle, n.Current.HCAObject)},
-	}
-	for _, f := range cgroupFiles {
-		if err := writeCgroupFile(path, f.Filename, f.Value); err != nil {
-			return fmt.Errorf("rdma subsystem: failed to set %s: %w", f.Filename, err)
+// Apply applies RDMA subsystem limits. The kernel accepts a single device per
+// write to rdma.max, so every device is written separately.
+func (n *RDMASubsystem) Apply(fs FileSystem, path string) error {
+	for _, line := range n.maxLines() {
+		if err := writeCgroupFile(fs, path, "rdma.max", line); err != nil {
+			return fmt.Errorf("rdma subsystem: failed to set rdma.max to %q: %w", line, err)
 		}
 	}
 	return nil
 }
+
+// maxLines returns the rdma.max line of every device, sorted by device name.
+func (n *RDMASubsystem) maxLines() []string {
+	lines := make([]string, 0, len(n.Limits))
+	for device, limit := range n.Limits {
+		lines = append(lines, fmt.Sprintf("%s hca_handle=%s hca_object=%s", device, formatRDMALimit(limit.HCAHandles), formatRDMALimit(limit.HCAObjects)))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func formatRDMALimit(value *uint32) string {
+	if value == nil {
+		return "max"
+	}
+	return strconv.FormatUint(uint64(*value), 10)
+}
+
+// Stat reads the per-device usage from rdma.current.
+func (n *RDMASubsystem) Stat(fs FileSystem, path string, stats *Stats) error {
+	content, err := readCgroupFile(fs, path, "rdma.current")
+	if err != nil {
+		return fmt.Errorf("rdma subsystem: failed to read rdma.current: %w", err)
+	}
+
+	stats.RDMA, err = parseRDMA(content)
+	if err != nil {
+		return fmt.Errorf("rdma subsystem: failed to parse rdma.current: %w", err)
+	}
+	return nil
+}
+
+// parseRDMA parses the "<device> hca_handle=<n> hca_object=<n>" lines of
+// rdma.current and rdma.max. An unlimited "max" value is reported as -1.
+func parseRDMA(content string) (map[string]RDMAHCA, error) {
+	devices := make(map[string]RDMAHCA)
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var hca RDMAHCA
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, fmt.Errorf("malformed field %q for device %s", field, fields[0])
+			}
+			count := int64(-1)
+			if value != "max" {
+				var err error
+				if count, err = strconv.ParseInt(value, 10, 64); err != nil {
+					return nil, fmt.Errorf("malformed %s value %q for device %s", key, value, fields[0])
+				}
+			}
+			switch key {
+			case "hca_handle":
+				hca.HCAHandle = count
+			case "hca_object":
+				hca.HCAObject = count
+			}
+		}
+		devices[fields[0]] = hca
+	}
+	return devices, nil
+}
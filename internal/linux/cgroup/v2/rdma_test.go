@@ -0,0 +1,55 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRDMAMaxLines(t *testing.T) {
+	handles, objects := uint32(2), uint32(2000)
+	r := &RDMASubsystem{Limits: map[string]RDMALimit{
+		"mlx5_1": {HCAObjects: &objects},
+		"mlx5_0": {HCAHandles: &handles, HCAObjects: &objects},
+	}}
+
+	want := []string{
+		"mlx5_0 hca_handle=2 hca_object=2000",
+		"mlx5_1 hca_handle=max hca_object=2000",
+	}
+	if got := r.maxLines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("rdma.max lines = %q, want %q", got, want)
+	}
+
+	// Every line is a separate write, so the fake file keeps the last one.
+	dir := t.TempDir()
+	if err := r.Apply(OSFileSystem{}, dir); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "rdma.max"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != want[1] {
+		t.Errorf("rdma.max = %q, want %q", content, want[1])
+	}
+}
+
+func TestParseRDMA(t *testing.T) {
+	got, err := parseRDMA("mlx5_0 hca_handle=2 hca_object=max\nmlx5_1 hca_handle=0 hca_object=7\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]RDMAHCA{
+		"mlx5_0": {HCAHandle: 2, HCAObject: -1},
+		"mlx5_1": {HCAHandle: 0, HCAObject: 7},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRDMA = %v, want %v", got, want)
+	}
+
+	if _, err := parseRDMA("mlx5_0 hca_handle=lots\n"); err == nil {
+		t.Error("parseRDMA accepted a malformed value")
+	}
+}
@@ -0,0 +1,92 @@
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// ReclaimMemory asks the kernel to reclaim amount bytes from the cgroup at
+// path through memory.reclaim, before the cgroup reaches its memory.high or
+// memory.max. A nil swappiness (0 to 200) keeps the cgroup's own balance
+// between reclaiming anonymous and file memory. ReclaimMemory returns how much
+// memory.current dropped, which can be less than amount when not enough
+// reclaimable memory was found.
+func ReclaimMemory(path string, amount uint64, swappiness *int) (uint64, error) {
+	return reclaimMemory(OSFileSystem{}, path, amount, swappiness)
+}
+
+func reclaimMemory(fs FileSystem, path string, amount uint64, swappiness *int) (uint64, error) {
+	if _, err := fs.Stat(filepath.Join(path, "memory.reclaim")); errors.Is(err, os.ErrNotExist) {
+		return 0, errors.New("cgroup: memory.reclaim is not supported; it needs cgroup v2 and Linux 5.19 or newer")
+	}
+	if swappiness != nil && (*swappiness < 0 || *swappiness > 200) {
+		return 0, fmt.Errorf("cgroup: swappiness %d is not between 0 and 200", *swappiness)
+	}
+
+	before, err := readMemoryCurrent(fs, path)
+	if err != nil {
+		return 0, err
+	}
+	value := strconv.FormatUint(amount, 10)
+	if swappiness != nil {
+		value += " swappiness=" + strconv.Itoa(*swappiness)
+	}
+	// EAGAIN reports that less than amount could be reclaimed.
+	if err := writeCgroupFile(fs, path, "memory.reclaim", value); err != nil && !errors.Is(err, syscall.EAGAIN) {
+		return 0, fmt.Errorf("cgroup: failed to write %q to memory.reclaim: %w", value, err)
+	}
+	after, err := readMemoryCurrent(fs, path)
+	if err != nil {
+		return 0, err
+	}
+
+	if after >= before {
+		return 0, nil
+	}
+	return before - after, nil
+}
+
+// ReclaimTarget returns how many bytes to reclaim from the cgroup at path so
+// that its working set makes up percent of its memory usage. The working set
+// is memory.current without the inactive file cache, which the kernel can
+// drop without hurting the workload.
+func ReclaimTarget(path string, percent uint64) (uint64, error) {
+	return reclaimTarget(OSFileSystem{}, path, percent)
+}
+
+func reclaimTarget(fs FileSystem, path string, percent uint64) (uint64, error) {
+	if percent == 0 || percent > 100 {
+		return 0, fmt.Errorf("cgroup: working set percentage %d is not between 1 and 100", percent)
+	}
+	current, err := readMemoryCurrent(fs, path)
+	if err != nil {
+		return 0, err
+	}
+	stat, err := readKeyValues(fs, path, "memory.stat")
+	if err != nil {
+		return 0, fmt.Errorf("cgroup: %w", err)
+	}
+
+	workingSet := current - min(current, stat["inactive_file"])
+	target := workingSet * 100 / percent
+	if current <= target {
+		return 0, nil
+	}
+	return current - target, nil
+}
+
+func readMemoryCurrent(fs FileSystem, path string) (uint64, error) {
+	content, err := readCgroupFile(fs, path, "memory.current")
+	if err != nil {
+		return 0, fmt.Errorf("cgroup: failed to read memory usage: %w", err)
+	}
+	current, err := parseUint(content)
+	if err != nil {
+		return 0, fmt.Errorf("cgroup: failed to parse memory.current: %w", err)
+	}
+	return current, nil
+}
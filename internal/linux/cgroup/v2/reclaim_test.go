@@ -0,0 +1,101 @@
+package cgroup
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// reclaimingFS frees up to reclaimable bytes of memory.current on writes to
+// memory.reclaim, failing with EAGAIN like the kernel when it frees less than
+// was asked for.
+type reclaimingFS struct {
+	*fakeCgroupFS
+	t           *testing.T
+	reclaimable uint64
+	written     []string
+}
+
+func (fs *reclaimingFS) WriteFile(name, value string) error {
+	if err := fs.fakeCgroupFS.WriteFile(name, value); err != nil || filepath.Base(name) != "memory.reclaim" {
+		return err
+	}
+	fs.written = append(fs.written, value)
+
+	amount, _, _ := strings.Cut(value, " ")
+	want, _ := strconv.ParseUint(amount, 10, 64)
+	freed := min(want, fs.reclaimable)
+	fs.reclaimable -= freed
+	current, _ := strconv.ParseUint(fs.read(fs.t, "/ctr", "memory.current"), 10, 64)
+	fs.set(fs.t, "/ctr", "memory.current", strconv.FormatUint(current-freed, 10))
+	if freed < want {
+		return syscall.EAGAIN
+	}
+	return nil
+}
+
+func TestReclaimMemory(t *testing.T) {
+	fake := newFakeCgroupFS(t, "memory")
+	fs := &reclaimingFS{fakeCgroupFS: fake, t: t, reclaimable: 3 << 20}
+	if err := fs.MkdirAll(filepath.Join(fs.root, "ctr")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCgroupFile(fs, fs.root, "cgroup.subtree_control", "+memory"); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(fs.root, "ctr")
+	fs.set(t, "/ctr", "memory.current", strconv.Itoa(10<<20))
+
+	reclaimed, err := reclaimMemory(fs, path, 2<<20, nil)
+	if err != nil || reclaimed != 2<<20 {
+		t.Errorf("ReclaimMemory = %d, %v, want %d", reclaimed, err, 2<<20)
+	}
+	swappiness := 0
+	reclaimed, err = reclaimMemory(fs, path, 2<<20, &swappiness)
+	if err != nil || reclaimed != 1<<20 {
+		t.Errorf("partial ReclaimMemory = %d, %v, want %d", reclaimed, err, 1<<20)
+	}
+	if want := []string{"2097152", "2097152 swappiness=0"}; strings.Join(fs.written, ",") != strings.Join(want, ",") {
+		t.Errorf("memory.reclaim writes = %q, want %q", fs.written, want)
+	}
+
+	swappiness = 201
+	if _, err := reclaimMemory(fs, path, 1, &swappiness); err == nil {
+		t.Error("ReclaimMemory accepted swappiness 201")
+	}
+	if _, err := reclaimMemory(fs, fs.root+"/missing", 1, nil); err == nil {
+		t.Error("ReclaimMemory succeeded on a cgroup without memory.reclaim")
+	}
+}
+
+func TestReclaimTarget(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"memory.current": strconv.Itoa(100 << 20),
+		"memory.stat":    "anon 40960\ninactive_file " + strconv.Itoa(60<<20) + "\n",
+	})
+
+	tests := map[uint64]uint64{
+		// A working set of 40MB makes up 80% of 50MB.
+		80:  50 << 20,
+		100: 60 << 20,
+		// The working set already makes up 40% of the usage.
+		40: 0,
+		10: 0,
+	}
+	for percent, want := range tests {
+		got, err := ReclaimTarget(dir, percent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("ReclaimTarget(%d%%) = %d, want %d", percent, got, want)
+		}
+	}
+
+	if _, err := ReclaimTarget(dir, 0); err == nil {
+		t.Error("ReclaimTarget accepted 0%")
+	}
+}
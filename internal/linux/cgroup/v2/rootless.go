@@ -0,0 +1,52 @@
+package cgroup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DelegatedCgroup returns the cgroup that systemd delegated to the calling
+// user, such as "/user.slice/user-1000.slice/user@1000.service". It is found
+// in the path of the runtime's own cgroup, which is inside it when the runtime
+// is started from the user's session.
+func DelegatedCgroup() (string, error) {
+	own, err := ownCgroup()
+	if err != nil {
+		return "", err
+	}
+	return delegatedCgroup(own, os.Geteuid())
+}
+
+func delegatedCgroup(own string, uid int) (string, error) {
+	unit := fmt.Sprintf("user@%d.service", uid)
+	parts := strings.Split(own, "/")
+	for i, part := range parts {
+		if part == unit {
+			return strings.Join(parts[:i+1], "/"), nil
+		}
+	}
+	return "", fmt.Errorf("cgroup: the runtime's cgroup %s is not inside %s; "+
+		"start it from a user session with cgroup delegation, for example with systemd-run --user --scope", own, unit)
+}
+
+// ResolveRootlessPath resolves an OCI linux.cgroupsPath for a rootless
+// container to a path below the delegated cgroup, relative to the cgroup root.
+// An empty cgroupsPath places the container in a "containeruntime" cgroup
+// there, and any other path is taken relative to the delegated cgroup unless
+// it already lies inside it.
+func ResolveRootlessPath(cgroupsPath, containerID, delegated string) (string, error) {
+	if cgroupsPath == "" {
+		return filepath.Join(delegated, "containeruntime", containerID), nil
+	}
+
+	path := filepath.Clean("/" + cgroupsPath)
+	if !strings.HasPrefix(path, delegated+"/") {
+		path = filepath.Join(delegated, path)
+	}
+	if path == delegated {
+		return "", fmt.Errorf("cgroup: cgroups path %q resolves to the delegated cgroup itself", cgroupsPath)
+	}
+	return path, nil
+}
@@ -0,0 +1,37 @@
+package cgroup
+
+import "testing"
+
+func TestDelegatedCgroup(t *testing.T) {
+	got, err := delegatedCgroup("/user.slice/user-1000.slice/user@1000.service/app.slice/run-u12.scope", 1000)
+	if err != nil || got != "/user.slice/user-1000.slice/user@1000.service" {
+		t.Errorf("delegatedCgroup = %q, %v", got, err)
+	}
+	if _, err := delegatedCgroup("/user.slice/user-1000.slice/session-2.scope", 1000); err == nil {
+		t.Error("delegatedCgroup outside user@1000.service succeeded, want error")
+	}
+	if _, err := delegatedCgroup("/user.slice/user-1001.slice/user@1001.service/app.slice", 1000); err == nil {
+		t.Error("delegatedCgroup of another user succeeded, want error")
+	}
+}
+
+func TestResolveRootlessPath(t *testing.T) {
+	const delegated = "/user.slice/user-1000.slice/user@1000.service"
+	tests := []struct {
+		cgroupsPath string
+		want        string
+		wantErr     bool
+	}{
+		{"", delegated + "/containeruntime/abc", false},
+		{"pods/abc", delegated + "/pods/abc", false},
+		{"/pods/abc", delegated + "/pods/abc", false},
+		{delegated + "/pods/abc", delegated + "/pods/abc", false},
+		{"/", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ResolveRootlessPath(tt.cgroupsPath, "abc", delegated)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolveRootlessPath(%q) = %q, %v, want %q (error %v)", tt.cgroupsPath, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Stats holds the statistics of a container cgroup. Each field is filled in by
+// the subsystem of the matching controller and left nil otherwise.
+type Stats struct {
+	CPU     *CPUStats
+	Cpuset  *CpusetStats
+	Memory  *MemoryStats
+	Pids    *PidsStats
+	IO      []IOStat
+	Hugetlb map[string]HugetlbStats
+	RDMA    map[string]RDMAHCA
+	Misc    map[string]MiscStats
+}
+
+// CPUStats holds the counters of cpu.stat.
+type CPUStats struct {
+	UsageUsec     uint64
+	UserUsec      uint64
+	SystemUsec    uint64
+	NrPeriods     uint64
+	NrThrottled   uint64
+	ThrottledUsec uint64
+	NrBursts      uint64
+	BurstUsec     uint64
+}
+
+// CpusetStats holds the CPUs and memory nodes the cgroup can actually use.
+type CpusetStats struct {
+	CpusEffective string
+	MemsEffective string
+}
+
+// MemoryStats holds the memory usage of a cgroup.
+type MemoryStats struct {
+	Current     uint64
+	Peak        uint64
+	SwapCurrent uint64
+	SwapPeak    uint64
+	Events      MemoryEvents
+	// Stat holds the breakdown from memory.stat, such as "anon" and "file".
+	Stat map[string]uint64
+}
+
+// MemoryEvents holds the counters of memory.events.
+type MemoryEvents struct {
+	Low          uint64
+	High         uint64
+	Max          uint64
+	OOM          uint64
+	OOMKill      uint64
+	OOMGroupKill uint64
+}
+
+// PidsStats holds the process counts of a cgroup.
+type PidsStats struct {
+	Current uint64
+	Peak    uint64
+	// MaxEvents counts the forks that failed because pids.max was reached.
+	MaxEvents uint64
+}
+
+// MiscStats holds the usage of one misc resource.
+type MiscStats struct {
+	Current  uint64
+	Capacity uint64
+	// MaxEvents counts the charges that failed because of misc.max.
+	MaxEvents uint64
+}
+
+// HugetlbStats holds the usage of one huge page size.
+type HugetlbStats struct {
+	Current     uint64
+	RsvdCurrent uint64
+	// MaxEvents counts the allocations that failed because of hugetlb.<size>.max.
+	MaxEvents uint64
+}
+
+// collectStats reads the statistics of every subsystem from the cgroup at path.
+func collectStats(fs FileSystem, path string, subsystems []SubSystem) (*Stats, error) {
+	if _, err := fs.Stat(path); err != nil {
+		return nil, fmt.Errorf("cgroup: failed to access cgroup: %w", err)
+	}
+
+	stats := &Stats{}
+	for _, s := range subsystems {
+		if err := s.Stat(fs, path, stats); err != nil {
+			return nil, fmt.Errorf("cgroup: subsystem %s stat failed: %w", s.Name(), err)
+		}
+	}
+	return stats, nil
+}
+
+// readCgroupFile reads a cgroup file with surrounding whitespace removed.
+func readCgroupFile(fs FileSystem, path, filename string) (string, error) {
+	content, err := fs.ReadFile(filepath.Join(path, filename))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// parseUint parses a cgroup value, mapping "max" to math.MaxUint64.
+func parseUint(value string) (uint64, error) {
+	if value == "max" {
+		return math.MaxUint64, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// readUint reads a single-value cgroup file into dst. A missing file, as on
+// kernels without that interface, leaves dst unchanged.
+func readUint(fs FileSystem, path, filename string, dst *uint64) error {
+	content, err := readCgroupFile(fs, path, filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	value, err := parseUint(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	*dst = value
+	return nil
+}
+
+// readKeyValues reads a flat keyed file such as cpu.stat or memory.events.
+// A missing file yields an empty map.
+func readKeyValues(fs FileSystem, path, filename string) (map[string]uint64, error) {
+	values := make(map[string]uint64)
+
+	content, err := fs.ReadFile(filepath.Join(path, filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := parseUint(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+		}
+		values[fields[0]] = value
+	}
+	return values, nil
+}
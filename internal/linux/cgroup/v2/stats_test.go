@@ -0,0 +1,86 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectStats(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"memory.current":      "4096\n",
+		"memory.peak":         "8192\n",
+		"memory.events":       "low 0\nhigh 2\nmax 3\noom 1\noom_kill 1\noom_group_kill 0\n",
+		"memory.stat":         "anon 1024\nfile 2048\n",
+		"pids.current":        "3\n",
+		"pids.events":         "max 5\n",
+		"cpu.stat":            "usage_usec 100\nuser_usec 60\nsystem_usec 40\nnr_periods 10\nnr_throttled 2\nthrottled_usec 500\n",
+		"hugetlb.2MB.current": "0\n",
+		"rdma.current":        "mlx4_0 hca_handle=2 hca_object=2000\nocrdma1 hca_handle=3 hca_object=7\n",
+	})
+
+	limit := int64(10)
+	stats, err := collectStats(OSFileSystem{}, dir, []SubSystem{
+		&MemorySubSystem{},
+		&PidsSubSystem{MaxPids: &limit},
+		&CPUSubSystem{},
+		&HugepageSubSystem{},
+		&RDMASubsystem{},
+	})
+	if err != nil {
+		t.Fatalf("collectStats failed: %v", err)
+	}
+
+	wantMemory := &MemoryStats{
+		Current: 4096,
+		Peak:    8192,
+		Events:  MemoryEvents{High: 2, Max: 3, OOM: 1, OOMKill: 1},
+		Stat:    map[string]uint64{"anon": 1024, "file": 2048},
+	}
+	if !reflect.DeepEqual(stats.Memory, wantMemory) {
+		t.Errorf("memory stats = %+v, want %+v", stats.Memory, wantMemory)
+	}
+	if want := (&PidsStats{Current: 3, MaxEvents: 5}); !reflect.DeepEqual(stats.Pids, want) {
+		t.Errorf("pids stats = %+v, want %+v", stats.Pids, want)
+	}
+	if stats.CPU == nil || stats.CPU.UsageUsec != 100 || stats.CPU.NrThrottled != 2 {
+		t.Errorf("cpu stats = %+v", stats.CPU)
+	}
+	if _, ok := stats.Hugetlb["2MB"]; !ok {
+		t.Errorf("hugetlb stats = %v, want an entry for 2MB", stats.Hugetlb)
+	}
+	wantRDMA := map[string]RDMAHCA{
+		"mlx4_0":  {HCAHandle: 2, HCAObject: 2000},
+		"ocrdma1": {HCAHandle: 3, HCAObject: 7},
+	}
+	if !reflect.DeepEqual(stats.RDMA, wantRDMA) {
+		t.Errorf("rdma stats = %v, want %v", stats.RDMA, wantRDMA)
+	}
+}
+
+func TestApplySkipsReadOnlyFiles(t *testing.T) {
+	dir := t.TempDir()
+	limit := int64(-1)
+	for _, s := range []SubSystem{&MemorySubSystem{}, &PidsSubSystem{MaxPids: &limit}, &RDMASubsystem{}} {
+		if err := s.Apply(OSFileSystem{}, dir); err != nil {
+			t.Fatalf("%s apply failed: %v", s.Name(), err)
+		}
+	}
+
+	for _, name := range []string{"memory.peak", "memory.swap.peak", "pids.current", "pids.events", "pids.events.local", "rdma.current"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("read-only file %s was written", name)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	systemdDestination      = "org.freedesktop.systemd1"
+	systemdObjectPath       = dbus.ObjectPath("/org/freedesktop/systemd1")
+	systemdManagerInterface = "org.freedesktop.systemd1.Manager"
+
+	defaultSystemdSlice = "system.slice"
+	systemdJobTimeout   = 30 * time.Second
+
+	// minSystemdCPUQuotaPeriod is the first systemd version that accepts the
+	// CPUQuotaPeriodUSec property.
+	minSystemdCPUQuotaPeriod = 242
+)
+
+// SystemdManager manages the cgroup of a container as a transient systemd
+// scope, so that systemd stays the single writer of the cgroup tree above it.
+type SystemdManager struct {
+	fs         FileSystem
+	root       string
+	slice      string
+	unit       string
+	subsystems []SubSystem
+	unified    map[string]string
+	bestEffort bool
+	connect    func() (systemdConn, error)
+}
+
+// systemdProperty is a unit property as passed to StartTransientUnit.
+type systemdProperty struct {
+	Name  string
+	Value dbus.Variant
+}
+
+// systemdConn is the part of the systemd D-Bus API used by SystemdManager.
+type systemdConn interface {
+	// StartTransientUnit starts a unit and waits for its job to finish.
+	StartTransientUnit(name string, properties []systemdProperty) error
+	// StopUnit stops a unit and waits for its job to finish.
+	StopUnit(name string) error
+	// Version returns the major version of systemd, such as 252.
+	Version() (int, error)
+	Close() error
+}
+
+// NewSystemdManager creates a SystemdManager from an OCI cgroupsPath in the
+// "slice:prefix:name" form. An empty cgroupsPath places the container in
+// system.slice, named after the container ID.
+func NewSystemdManager(cgroupsPath, containerID string, subsystems []SubSystem) (*SystemdManager, error) {
+	slice, unit, err := ParseSystemdPath(cgroupsPath, containerID)
+	if err != nil {
+		return nil, err
+	}
+	return &SystemdManager{
+		fs:         OSFileSystem{},
+		root:       DefaultRoot,
+		slice:      slice,
+		unit:       unit,
+		subsystems: subsystems,
+		connect:    connectSystemd,
+	}, nil
+}
+
+// ParseSystemdPath splits a "slice:prefix:name" cgroupsPath into the slice and
+// the scope unit name.
+func ParseSystemdPath(cgroupsPath, containerID string) (slice, unit string, err error) {
+	if cgroupsPath == "" {
+		return defaultSystemdSlice, "containeruntime-" + containerID + ".scope", nil
+	}
+
+	parts := strings.Split(cgroupsPath, ":")
+	if len(parts) != 3 {
+		return "", "", fmt.Errorf("cgroup: systemd cgroups path %q must have the form slice:prefix:name", cgroupsPath)
+	}
+	slice, prefix, name := parts[0], parts[1], parts[2]
+
+	if slice == "" {
+		slice = defaultSystemdSlice
+	}
+	if !strings.HasSuffix(slice, ".slice") || strings.Contains(slice, "/") {
+		return "", "", fmt.Errorf("cgroup: invalid systemd slice %q", slice)
+	}
+	if name == "" || strings.Contains(name, "/") || strings.HasSuffix(name, ".slice") {
+		return "", "", fmt.Errorf("cgroup: invalid systemd unit name %q", name)
+	}
+
+	unit = name
+	if prefix != "" {
+		unit = prefix + "-" + name
+	}
+	if !strings.HasSuffix(unit, ".scope") {
+		unit += ".scope"
+	}
+	return slice, unit, nil
+}
+
+// expandSlice returns the cgroup path of a slice, such as
+// "/a.slice/a-b.slice" for "a-b.slice".
+func expandSlice(slice string) (string, error) {
+	name := strings.TrimSuffix(slice, ".slice")
+	if name == "-" {
+		return "/", nil
+	}
+	if name == "" || strings.HasPrefix(name, "-") || strings.HasSuffix(name, "-") || strings.Contains(name, "--") {
+		return "", fmt.Errorf("cgroup: invalid systemd slice %q", slice)
+	}
+
+	path := "/"
+	prefix := ""
+	for _, component := range strings.Split(name, "-") {
+		prefix += component
+		path = filepath.Join(path, prefix+".slice")
+		prefix += "-"
+	}
+	return path, nil
+}
+
+// SetRoot sets the mount point of the cgroup hierarchy, DefaultRoot by default.
+func (m *SystemdManager) SetRoot(root string) {
+	m.root = root
+}
+
+// SetFileSystem sets the filesystem the cgroup hierarchy is accessed
+// through, OSFileSystem by default.
+func (m *SystemdManager) SetFileSystem(fs FileSystem) {
+	m.fs = fs
+}
+
+// SetUnified sets the raw cgroup file values from linux.resources.unified.
+// They are written after all subsystems, so they take precedence.
+func (m *SystemdManager) SetUnified(values map[string]string) {
+	m.unified = values
+}
+
+// SetBestEffort makes AddProcess skip, with a warning, the subsystems whose
+// controller is not available in the scope instead of failing.
+func (m *SystemdManager) SetBestEffort(bestEffort bool) {
+	m.bestEffort = bestEffort
+}
+
+// Setup validates the slice. A scope cannot exist without a process, so it is
+// created by AddProcess.
+func (m *SystemdManager) Setup() error {
+	_, err := expandSlice(m.slice)
+	return err
+}
+
+// Path returns the path of the container cgroup.
+func (m *SystemdManager) Path() string {
+	slicePath, err := expandSlice(m.slice)
+	if err != nil {
+		slicePath = "/"
+	}
+	return filepath.Join(m.root, slicePath, m.unit)
+}
+
+// Unit returns the name of the container's scope unit.
+func (m *SystemdManager) Unit() string {
+	return m.unit
+}
+
+// AddProcess starts the container's scope with the process in it, then
+// writes the settings that have no unit property directly to its cgroup.
+// Settings passed as unit properties are left to systemd, which would
+// overwrite values written over them on its next daemon-reload.
+func (m *SystemdManager) AddProcess(pid int) error {
+	conn, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	version, err := conn.Version()
+	if err != nil {
+		return fmt.Errorf("cgroup: failed to read the systemd version: %w", err)
+	}
+
+	properties := []systemdProperty{
+		{"Description", dbus.MakeVariant("containeruntime container " + m.unit)},
+		{"Slice", dbus.MakeVariant(m.slice)},
+		{"Delegate", dbus.MakeVariant(true)},
+		{"DefaultDependencies", dbus.MakeVariant(false)},
+		{"PIDs", dbus.MakeVariant([]uint32{uint32(pid)})},
+	}
+	resourceProperties, direct, err := m.resourceProperties(version)
+	if err != nil {
+		return err
+	}
+	properties = append(properties, resourceProperties...)
+
+	if err := conn.StartTransientUnit(m.unit, properties); err != nil {
+		return fmt.Errorf("cgroup: failed to start unit %s: %w", m.unit, err)
+	}
+
+	// The scope is delegated, so the remaining knobs can be written directly.
+	path := m.Path()
+	subsystems, err := availableSubsystems(m.fs, path, m.subsystems, m.bestEffort)
+	if err != nil {
+		return err
+	}
+	m.subsystems = subsystems
+	for _, s := range direct {
+		if !slices.ContainsFunc(m.subsystems, func(available SubSystem) bool { return available.Name() == s.Name() }) {
+			continue
+		}
+		if err := s.Apply(m.fs, path); err != nil {
+			return fmt.Errorf("cgroup: subsystem %s apply failed: %w", s.Name(), err)
+		}
+	}
+	return writeUnified(m.fs, path, m.unified, m.bestEffort)
+}
+
+// Stats reads the statistics of every configured subsystem.
+func (m *SystemdManager) Stats() (*Stats, error) {
+	return collectStats(m.fs, m.Path(), m.subsystems)
+}
+
+// Kill kills every process in the container's scope and waits until it is empty.
+func (m *SystemdManager) Kill() error {
+	return killCgroup(m.fs, m.Path())
+}
+
+// Clean stops the container's scope, which makes systemd remove its cgroup.
+func (m *SystemdManager) Clean() error {
+	conn, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var dbusErr dbus.Error
+	if err := conn.StopUnit(m.unit); err != nil {
+		if errors.As(err, &dbusErr) && dbusErr.Name == "org.freedesktop.systemd1.NoSuchUnit" {
+			return nil
+		}
+		return fmt.Errorf("cgroup: failed to stop unit %s: %w", m.unit, err)
+	}
+	return nil
+}
+
+// resourceProperties translates the subsystems to the unit properties that the
+// given systemd version supports. The settings it cannot express are returned
+// as subsystems holding only those settings, to be written to the delegated
+// scope directly.
+func (m *SystemdManager) resourceProperties(version int) ([]systemdProperty, []SubSystem, error) {
+	var properties []systemdProperty
+	var direct []SubSystem
+	addLimit := func(name string, value *int64) {
+		if value != nil {
+			properties = append(properties, systemdProperty{name, dbus.MakeVariant(systemdLimit(*value))})
+		}
+	}
+
+	for _, s := range m.subsystems {
+		switch s := s.(type) {
+		case *MemorySubSystem:
+			addLimit("MemoryMin", s.Min)
+			addLimit("MemoryLow", s.Low)
+			addLimit("MemoryHigh", s.High)
+			addLimit("MemoryMax", s.Max)
+			addLimit("MemorySwapMax", s.SwapMax)
+			if s.OOMGroup != nil || s.SwapHigh != nil || s.ZswapMax != nil || s.ZswapWriteback != nil {
+				direct = append(direct, &MemorySubSystem{OOMGroup: s.OOMGroup, SwapHigh: s.SwapHigh, ZswapMax: s.ZswapMax, ZswapWriteback: s.ZswapWriteback})
+			}
+		case *CPUSubSystem:
+			if s.Weight != nil {
+				properties = append(properties, systemdProperty{"CPUWeight", dbus.MakeVariant(*s.Weight)})
+			}
+			rest := &CPUSubSystem{MaxBurst: s.MaxBurst, Idle: s.Idle}
+			if version >= minSystemdCPUQuotaPeriod {
+				if s.Period != nil {
+					properties = append(properties, systemdProperty{"CPUQuotaPeriodUSec", dbus.MakeVariant(*s.Period)})
+				}
+			} else if s.Period != nil {
+				// Without CPUQuotaPeriodUSec, systemd assumes the default period,
+				// so cpu.max is written directly with the requested one.
+				rest.Quota, rest.Period = s.Quota, s.Period
+			}
+			if s.Quota != nil {
+				properties = append(properties, systemdProperty{"CPUQuotaPerSecUSec", dbus.MakeVariant(cpuQuotaPerSecUSec(*s.Quota, s.Period))})
+			}
+			if rest.MaxBurst != nil || rest.Idle != nil || rest.Period != nil {
+				direct = append(direct, rest)
+			}
+		case *PidsSubSystem:
+			addLimit("TasksMax", s.MaxPids)
+		case *IOSubSystem:
+			if s.Weight != nil {
+				properties = append(properties, systemdProperty{"IOWeight", dbus.MakeVariant(*s.Weight)})
+			}
+			if len(s.DeviceWeights) > 0 || len(s.DeviceLimits) > 0 || len(s.DeviceLatency) > 0 {
+				direct = append(direct, &IOSubSystem{DeviceWeights: s.DeviceWeights, DeviceLimits: s.DeviceLimits, DeviceLatency: s.DeviceLatency})
+			}
+		case *CpusetSubSystem:
+			if s.Cpus != "" {
+				mask, err := listToBitmask(s.Cpus)
+				if err != nil {
+					return nil, nil, err
+				}
+				properties = append(properties, systemdProperty{"AllowedCPUs", dbus.MakeVariant(mask)})
+			}
+			if s.Mems != "" {
+				mask, err := listToBitmask(s.Mems)
+				if err != nil {
+					return nil, nil, err
+				}
+				properties = append(properties, systemdProperty{"AllowedMemoryNodes", dbus.MakeVariant(mask)})
+			}
+			if s.Partition != "" {
+				direct = append(direct, &CpusetSubSystem{Partition: s.Partition})
+			}
+		default:
+			direct = append(direct, s)
+		}
+	}
+	return properties, direct, nil
+}
+
+// systemdLimit converts a limit where -1 means unlimited to systemd's
+// representation of "infinity".
+func systemdLimit(value int64) uint64 {
+	if value < 0 {
+		return math.MaxUint64
+	}
+	return uint64(value)
+}
+
+// cpuQuotaPerSecUSec converts a quota per period to CPU time per second,
+// rounded up to the 10ms granularity systemd uses.
+func cpuQuotaPerSecUSec(quota int64, period *uint64) uint64 {
+	if quota < 0 {
+		return math.MaxUint64
+	}
+	p := uint64(100000)
+	if period != nil && *period != 0 {
+		p = *period
+	}
+	perSec := uint64(quota) * 1000000 / p
+	if rem := perSec % 10000; rem != 0 {
+		perSec += 10000 - rem
+	}
+	return perSec
+}
+
+// listToBitmask converts a cpuset list to the byte mask used by AllowedCPUs
+// and AllowedMemoryNodes, where bit n of byte n/8 stands for member n.
+func listToBitmask(list string) ([]byte, error) {
+	members, err := ParseList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	var mask []byte
+	for member := range members {
+		for len(mask) <= member/8 {
+			mask = append(mask, 0)
+		}
+		mask[member/8] |= 1 << (member % 8)
+	}
+	return mask, nil
+}
+
+// dbusSystemdConn talks to systemd over the system bus.
+type dbusSystemdConn struct {
+	conn    *dbus.Conn
+	signals chan *dbus.Signal
+}
+
+// SystemdAvailable reports whether systemd can be reached over the system bus.
+func SystemdAvailable() bool {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	return systemdReachable(conn)
+}
+
+// systemdReachable reports whether systemd owns its name on the bus of conn.
+func systemdReachable(conn *dbus.Conn) bool {
+	var hasOwner bool
+	err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, systemdDestination).Store(&hasOwner)
+	return err == nil && hasOwner
+}
+
+func connectSystemd() (systemdConn, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("cgroup: failed to connect to the system bus: %w", err)
+	}
+	return newDBusSystemdConn(conn)
+}
+
+// newDBusSystemdConn subscribes to the job signals of the systemd reachable
+// over conn. It takes ownership of conn.
+func newDBusSystemdConn(conn *dbus.Conn) (*dbusSystemdConn, error) {
+	c := &dbusSystemdConn{conn: conn, signals: make(chan *dbus.Signal, 16)}
+	conn.Signal(c.signals)
+
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchInterface(systemdManagerInterface),
+		dbus.WithMatchMember("JobRemoved"),
+	); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("cgroup: failed to watch systemd jobs: %w", err)
+	}
+
+	// systemd only emits job signals while at least one client is subscribed.
+	if err := c.manager().Call(systemdManagerInterface+".Subscribe", 0).Err; err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("cgroup: failed to subscribe to systemd: %w", err)
+	}
+	return c, nil
+}
+
+func (c *dbusSystemdConn) manager() dbus.BusObject {
+	return c.conn.Object(systemdDestination, systemdObjectPath)
+}
+
+func (c *dbusSystemdConn) StartTransientUnit(name string, properties []systemdProperty) error {
+	type auxUnit struct {
+		Name       string
+		Properties []systemdProperty
+	}
+
+	var job dbus.ObjectPath
+	call := c.manager().Call(systemdManagerInterface+".StartTransientUnit", 0, name, "replace", properties, []auxUnit{})
+	if err := call.Store(&job); err != nil {
+		return err
+	}
+	return c.waitJob(job)
+}
+
+func (c *dbusSystemdConn) StopUnit(name string) error {
+	var job dbus.ObjectPath
+	if err := c.manager().Call(systemdManagerInterface+".StopUnit", 0, name, "replace").Store(&job); err != nil {
+		return err
+	}
+	return c.waitJob(job)
+}
+
+func (c *dbusSystemdConn) Version() (int, error) {
+	value, err := c.manager().GetProperty(systemdManagerInterface + ".Version")
+	if err != nil {
+		return 0, err
+	}
+	version, _ := value.Value().(string)
+	return parseSystemdVersion(version)
+}
+
+// parseSystemdVersion returns the major version from the Version property of
+// systemd, such as "252.19-1~deb12u1" or "v255-rc1".
+func parseSystemdVersion(version string) (int, error) {
+	digits := strings.TrimPrefix(version, "v")
+	if end := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+		digits = digits[:end]
+	}
+	major, err := strconv.Atoi(digits)
+	if err != nil {
+		return 0, fmt.Errorf("cgroup: invalid systemd version %q", version)
+	}
+	return major, nil
+}
+
+func (c *dbusSystemdConn) Close() error {
+	return c.conn.Close()
+}
+
+// waitJob waits for the JobRemoved signal of a job and checks its result.
+func (c *dbusSystemdConn) waitJob(job dbus.ObjectPath) error {
+	timeout := time.After(systemdJobTimeout)
+	for {
+		select {
+		case signal, ok := <-c.signals:
+			if !ok {
+				return errors.New("cgroup: system bus connection closed")
+			}
+			if signal.Name != systemdManagerInterface+".JobRemoved" || len(signal.Body) != 4 {
+				continue
+			}
+			if path, _ := signal.Body[1].(dbus.ObjectPath); path != job {
+				continue
+			}
+			if result, _ := signal.Body[3].(string); result != "done" {
+				return fmt.Errorf("cgroup: systemd job %s finished with result %q", job, result)
+			}
+			return nil
+		case <-timeout:
+			return fmt.Errorf("cgroup: timed out waiting for systemd job %s", job)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package cgroup
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+// fakeSystemdConn stands in for the system bus, creating the scope's cgroup
+// directory under root the way systemd would.
+type fakeSystemdConn struct {
+	root       string
+	slicePath  string
+	started    map[string][]systemdProperty
+	stopped    []string
+	stopErr    error
+	version    int
+	closeCount int
+}
+
+func (c *fakeSystemdConn) StartTransientUnit(name string, properties []systemdProperty) error {
+	c.started[name] = properties
+	return os.MkdirAll(filepath.Join(c.root, c.slicePath, name), 0o755)
+}
+
+func (c *fakeSystemdConn) StopUnit(name string) error {
+	c.stopped = append(c.stopped, name)
+	return c.stopErr
+}
+
+func (c *fakeSystemdConn) Version() (int, error) {
+	return c.version, nil
+}
+
+func (c *fakeSystemdConn) Close() error {
+	c.closeCount++
+	return nil
+}
+
+func TestParseSystemdPath(t *testing.T) {
+	tests := []struct {
+		cgroupsPath string
+		wantSlice   string
+		wantUnit    string
+		wantErr     bool
+	}{
+		{"", "system.slice", "containeruntime-abc.scope", false},
+		{"machine.slice:ctr:abc", "machine.slice", "ctr-abc.scope", false},
+		{":ctr:abc", "system.slice", "ctr-abc.scope", false},
+		{"tenant-a.slice::abc.scope", "tenant-a.slice", "abc.scope", false},
+		{"machine.slice:abc", "", "", true},
+		{"machine:ctr:abc", "", "", true},
+		{"machine.slice:ctr:", "", "", true},
+		{"machine.slice:ctr:../abc", "", "", true},
+	}
+
+	for _, tt := range tests {
+		slice, unit, err := ParseSystemdPath(tt.cgroupsPath, "abc")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSystemdPath(%q) error = %v, wantErr %v", tt.cgroupsPath, err, tt.wantErr)
+			continue
+		}
+		if slice != tt.wantSlice || unit != tt.wantUnit {
+			t.Errorf("ParseSystemdPath(%q) = %q, %q, want %q, %q", tt.cgroupsPath, slice, unit, tt.wantSlice, tt.wantUnit)
+		}
+	}
+}
+
+func TestExpandSlice(t *testing.T) {
+	tests := map[string]string{
+		"-.slice":            "/",
+		"system.slice":       "/system.slice",
+		"tenant-a-web.slice": "/tenant.slice/tenant-a.slice/tenant-a-web.slice",
+	}
+	for slice, want := range tests {
+		got, err := expandSlice(slice)
+		if err != nil || got != want {
+			t.Errorf("expandSlice(%q) = %q, %v, want %q", slice, got, err, want)
+		}
+	}
+
+	for _, slice := range []string{"a--b.slice", "-a.slice", "a-.slice", ".slice"} {
+		if _, err := expandSlice(slice); err == nil {
+			t.Errorf("expandSlice(%q) succeeded, want error", slice)
+		}
+	}
+}
+
+func TestSystemdManagerAddProcess(t *testing.T) {
+	memMax := int64(512 << 20)
+	pids := int64(-1)
+	weight := uint64(100)
+	quota := int64(50000)
+	period := uint64(100000)
+	burst := uint64(1000)
+
+	m, err := NewSystemdManager("tenant-a.slice:ctr:abc", "abc", []SubSystem{
+		&MemorySubSystem{Max: &memMax},
+		&PidsSubSystem{MaxPids: &pids},
+		&CPUSubSystem{Weight: &weight, Quota: &quota, Period: &period, MaxBurst: &burst},
+		&CpusetSubSystem{Cpus: "0-1,9"},
+	})
+	if err != nil {
+		t.Fatalf("NewSystemdManager failed: %v", err)
+	}
+
+	root := t.TempDir()
+	m.SetRoot(root)
+	conn := &fakeSystemdConn{
+		root:      root,
+		slicePath: "tenant.slice/tenant-a.slice",
+		started:   make(map[string][]systemdProperty),
+		version:   252,
+	}
+	m.connect = func() (systemdConn, error) { return conn, nil }
+
+	sliceDir := filepath.Join(root, conn.slicePath)
+	if err := os.MkdirAll(sliceDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, sliceDir, map[string]string{
+		"cgroup.controllers":    "cpuset cpu memory pids\n",
+		"cpuset.cpus.effective": "0-15\n",
+	})
+
+	if err := m.Setup(); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	if err := m.AddProcess(1234); err != nil {
+		t.Fatalf("AddProcess failed: %v", err)
+	}
+
+	properties, ok := conn.started["ctr-abc.scope"]
+	if !ok {
+		t.Fatalf("unit ctr-abc.scope was not started, got %v", conn.started)
+	}
+	got := make(map[string]any)
+	for _, p := range properties {
+		got[p.Name] = p.Value.Value()
+	}
+	want := map[string]any{
+		"Description":         "containeruntime container ctr-abc.scope",
+		"Slice":               "tenant-a.slice",
+		"Delegate":            true,
+		"DefaultDependencies": false,
+		"PIDs":                []uint32{1234},
+		"MemoryMax":           uint64(512 << 20),
+		"TasksMax":            uint64(math.MaxUint64),
+		"CPUWeight":           uint64(100),
+		"CPUQuotaPeriodUSec":  uint64(100000),
+		"CPUQuotaPerSecUSec":  uint64(500000),
+		"AllowedCPUs":         []byte{0x03, 0x02},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unit properties = %v, want %v", got, want)
+	}
+
+	// Knobs without a unit property are written to the delegated scope.
+	wantPath := filepath.Join(root, "tenant.slice", "tenant-a.slice", "ctr-abc.scope")
+	if m.Path() != wantPath {
+		t.Errorf("Path() = %q, want %q", m.Path(), wantPath)
+	}
+	burstContent, err := os.ReadFile(filepath.Join(wantPath, "cpu.max.burst"))
+	if err != nil || string(burstContent) != "1000" {
+		t.Errorf("cpu.max.burst = %q, %v, want \"1000\"", burstContent, err)
+	}
+	// Knobs passed as unit properties are left to systemd.
+	for _, name := range []string{"memory.max", "pids.max", "cpu.max", "cpu.weight", "cpuset.cpus"} {
+		if _, err := os.Stat(filepath.Join(wantPath, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was written to the scope, want it set only as a unit property", name)
+		}
+	}
+}
+
+func TestSystemdManagerCleanIgnoresMissingUnit(t *testing.T) {
+	m, err := NewSystemdManager("", "abc", nil)
+	if err != nil {
+		t.Fatalf("NewSystemdManager failed: %v", err)
+	}
+	conn := &fakeSystemdConn{
+		stopErr: dbus.Error{Name: "org.freedesktop.systemd1.NoSuchUnit"},
+	}
+	m.connect = func() (systemdConn, error) { return conn, nil }
+
+	if err := m.Clean(); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	if !reflect.DeepEqual(conn.stopped, []string{"containeruntime-abc.scope"}) {
+		t.Errorf("stopped units = %v", conn.stopped)
+	}
+	if conn.closeCount != 1 {
+		t.Errorf("connection closed %d times, want 1", conn.closeCount)
+	}
+}
+
+func TestSystemdManagerOmitsCPUQuotaPeriodOnOldSystemd(t *testing.T) {
+	quota, period := int64(50000), uint64(50000)
+	cpu := &CPUSubSystem{Quota: &quota, Period: &period}
+	m, err := NewSystemdManager("", "abc", []SubSystem{cpu})
+	if err != nil {
+		t.Fatalf("NewSystemdManager failed: %v", err)
+	}
+
+	for version, wantPeriod := range map[int]bool{241: false, 242: true} {
+		properties, direct, err := m.resourceProperties(version)
+		if err != nil {
+			t.Fatalf("resourceProperties(%d) failed: %v", version, err)
+		}
+		// Without the period property, cpu.max is written directly instead.
+		var wantDirect []SubSystem
+		if !wantPeriod {
+			wantDirect = []SubSystem{&CPUSubSystem{Quota: &quota, Period: &period}}
+		}
+		if !reflect.DeepEqual(direct, wantDirect) {
+			t.Errorf("resourceProperties(%d) writes %v directly, want %v", version, direct, wantDirect)
+		}
+		hasPeriod := false
+		for _, p := range properties {
+			hasPeriod = hasPeriod || p.Name == "CPUQuotaPeriodUSec"
+		}
+		if hasPeriod != wantPeriod {
+			t.Errorf("resourceProperties(%d) sets CPUQuotaPeriodUSec = %v, want %v", version, hasPeriod, wantPeriod)
+		}
+	}
+}
+
+func TestParseSystemdVersion(t *testing.T) {
+	tests := map[string]int{
+		"252.19-1~deb12u1": 252,
+		"v255-rc1":         255,
+		"239":              239,
+		"245.4-4ubuntu3":   245,
+	}
+	for version, want := range tests {
+		got, err := parseSystemdVersion(version)
+		if err != nil || got != want {
+			t.Errorf("parseSystemdVersion(%q) = %d, %v, want %d", version, got, err, want)
+		}
+	}
+	for _, version := range []string{"", "v", "systemd"} {
+		if _, err := parseSystemdVersion(version); err == nil {
+			t.Errorf("parseSystemdVersion(%q) succeeded, want error", version)
+		}
+	}
+}
+
+// busSystemd implements the part of the systemd manager interface used by
+// dbusSystemdConn on a private bus.
+type busSystemd struct {
+	conn *dbus.Conn
+
+	mu      sync.Mutex
+	jobs    uint32
+	started map[string][]systemdProperty
+}
+
+func (s *busSystemd) Subscribe() *dbus.Error {
+	return nil
+}
+
+// StartTransientUnit announces an unrelated job before the unit's own, whose
+// result is "failed" for units named fail.scope.
+func (s *busSystemd) StartTransientUnit(name, mode string, properties []systemdProperty, aux []struct {
+	Name       string
+	Properties []systemdProperty
+}) (dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	s.started[name] = properties
+	s.jobs += 2
+	id := s.jobs
+	s.mu.Unlock()
+
+	other := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/systemd1/job/%d", id-1))
+	job := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/systemd1/job/%d", id))
+	result := "done"
+	if name == "fail.scope" {
+		result = "failed"
+	}
+	s.emitJobRemoved(id-1, other, "other.service", "failed")
+	s.emitJobRemoved(id, job, name, result)
+	return job, nil
+}
+
+func (s *busSystemd) emitJobRemoved(id uint32, job dbus.ObjectPath, unit, result string) {
+	_ = s.conn.Emit(systemdObjectPath, systemdManagerInterface+".JobRemoved", id, job, unit, result)
+}
+
+// startBus starts a private dbus-daemon and returns its address.
+func startBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	writeFiles(t, dir, map[string]string{"bus.conf": `<busconfig>
+  <type>session</type>
+  <listen>unix:path=` + filepath.Join(dir, "bus") + `</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`})
+
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read the bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func TestDBusSystemdConn(t *testing.T) {
+	address := startBus(t)
+
+	serverConn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close()
+	server := &busSystemd{conn: serverConn, started: make(map[string][]systemdProperty)}
+	if err := serverConn.Export(server, systemdObjectPath, systemdManagerInterface); err != nil {
+		t.Fatal(err)
+	}
+	// systemd 241 predates CPUQuotaPeriodUSec, so the unit must not set it.
+	if _, err := prop.Export(serverConn, systemdObjectPath, prop.Map{
+		systemdManagerInterface: {"Version": {Value: "241.7-2", Emit: prop.EmitFalse}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if systemdReachable(serverConn) {
+		t.Error("systemd is reachable before it owns its name")
+	}
+	if reply, err := serverConn.RequestName(systemdDestination, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v, %v", systemdDestination, reply, err)
+	}
+	if !systemdReachable(serverConn) {
+		t.Error("systemd is not reachable after owning its name")
+	}
+
+	connect := func() (systemdConn, error) {
+		conn, err := dbus.Connect(address)
+		if err != nil {
+			return nil, err
+		}
+		return newDBusSystemdConn(conn)
+	}
+
+	memMax := int64(256 << 20)
+	quota, period := int64(50000), uint64(100000)
+	m, err := NewSystemdManager("machine.slice:ctr:abc", "abc", []SubSystem{
+		&MemorySubSystem{Max: &memMax},
+		&CPUSubSystem{Quota: &quota, Period: &period},
+		&CpusetSubSystem{Cpus: "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	m.SetRoot(root)
+	m.connect = connect
+	// No systemd creates the scope's cgroup on a private bus.
+	if err := os.MkdirAll(filepath.Join(root, "machine.slice", "ctr-abc.scope"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, filepath.Join(root, "machine.slice"), map[string]string{
+		"cgroup.controllers":    "cpuset cpu memory\n",
+		"cpuset.cpus.effective": "0-3\n",
+	})
+	if err := m.AddProcess(1234); err != nil {
+		t.Fatalf("AddProcess failed: %v", err)
+	}
+
+	server.mu.Lock()
+	properties := server.started["ctr-abc.scope"]
+	server.mu.Unlock()
+	got := make(map[string]string)
+	for _, p := range properties {
+		got[p.Name] = p.Value.Signature().String() + " " + p.Value.String()
+	}
+	want := map[string]string{
+		"Description":         `s "containeruntime container ctr-abc.scope"`,
+		"Slice":               `s "machine.slice"`,
+		"Delegate":            "b true",
+		"DefaultDependencies": "b false",
+		"PIDs":                "au @au [1234]",
+		"MemoryMax":           "t @t 268435456",
+		"CPUQuotaPerSecUSec":  "t @t 500000",
+		"AllowedCPUs":         "ay @ay [0x2]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unit properties = %v, want %v", got, want)
+	}
+
+	conn, err := connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if version, err := conn.Version(); err != nil || version != 241 {
+		t.Errorf("Version() = %d, %v, want 241", version, err)
+	}
+	if err := conn.StartTransientUnit("ok.scope", nil); err != nil {
+		t.Errorf("StartTransientUnit(ok.scope) = %v, want nil", err)
+	}
+	if err := conn.StartTransientUnit("fail.scope", nil); err == nil || !strings.Contains(err.Error(), `"failed"`) {
+		t.Errorf("StartTransientUnit(fail.scope) = %v, want a failed job", err)
+	}
+}
@@ -0,0 +1,71 @@
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ValidateUnifiedKey checks that a linux.resources.unified key names a
+// controller file directly inside the cgroup directory, such as
+// "memory.zswap.writeback". The cgroup core files, such as cgroup.procs and
+// cgroup.subtree_control, are managed by the runtime and cannot be set.
+func ValidateUnifiedKey(key string) error {
+	if key == "" || key == "." || key == ".." {
+		return fmt.Errorf("cgroup: invalid unified key %q", key)
+	}
+	if strings.ContainsAny(key, "/\x00") {
+		return fmt.Errorf("cgroup: unified key %q must not contain a path separator", key)
+	}
+	controller, name, ok := strings.Cut(key, ".")
+	if !ok || controller == "" || name == "" {
+		return fmt.Errorf("cgroup: unified key %q must have the form <controller>.<file>", key)
+	}
+	if controller == "cgroup" {
+		return fmt.Errorf("cgroup: unified key %q names a cgroup core file, which the runtime manages", key)
+	}
+	return nil
+}
+
+// writeUnified writes linux.resources.unified values to the cgroup at path,
+// enabling the controller named by each key's prefix in the ancestors first.
+// In best-effort mode, keys of unavailable controllers are skipped with a warning.
+func writeUnified(fs FileSystem, path string, values map[string]string, bestEffort bool) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if err := ValidateUnifiedKey(key); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	enabled := make(map[string]bool)
+	for _, key := range keys {
+		controller, _, _ := strings.Cut(key, ".")
+		if !enabled[controller] {
+			err := enableControllerInAncestors(fs, path, controller)
+			var unavailableErr *ControllerUnavailableError
+			if bestEffort && errors.As(err, &unavailableErr) {
+				log.Printf("cgroup: warning: skipping unified key %s: %v", key, err)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("cgroup: %w", err)
+			}
+			enabled[controller] = true
+		}
+
+		if _, err := fs.Stat(filepath.Join(path, key)); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("cgroup: unified key %q is not supported by this kernel", key)
+		}
+		if err := writeCgroupFile(fs, path, key, values[key]); err != nil {
+			return fmt.Errorf("cgroup: failed to set unified key %s: %w", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateUnifiedKey(t *testing.T) {
+	for _, key := range []string{"memory.oom.group", "memory.zswap.writeback", "cpu.idle", "io.latency"} {
+		if err := ValidateUnifiedKey(key); err != nil {
+			t.Errorf("ValidateUnifiedKey(%q): %v", key, err)
+		}
+	}
+
+	for _, key := range []string{
+		"", ".", "..", "memory", ".max", "memory.",
+		"../memory.max", "ctr/memory.max", "/sys/fs/cgroup/memory.max", "memory.max\x00",
+		"cgroup.procs", "cgroup.subtree_control", "cgroup.kill", "cgroup.freeze", "cgroup.max.depth",
+	} {
+		if err := ValidateUnifiedKey(key); err == nil {
+			t.Errorf("ValidateUnifiedKey(%q) succeeded, want error", key)
+		}
+	}
+}
+
+func TestWriteUnifiedStaysInsideTheCgroup(t *testing.T) {
+	fs := newFakeCgroupFS(t, "memory")
+	if err := fs.MkdirAll(fs.root + "/ctr"); err != nil {
+		t.Fatal(err)
+	}
+	fs.set(t, "/", "memory.max", "max\n")
+
+	for _, key := range []string{"../memory.max", "cgroup.subtree_control"} {
+		if err := writeUnified(fs, fs.root+"/ctr", map[string]string{key: "0"}, false); err == nil {
+			t.Errorf("writeUnified(%q) succeeded, want error", key)
+		}
+	}
+	if got := fs.read(t, "/", "memory.max"); got != "max" {
+		t.Errorf("parent memory.max = %q after an escaping key, want max", got)
+	}
+	if got := fs.read(t, "/", "cgroup.subtree_control"); got != "" {
+		t.Errorf("cgroup.subtree_control = %q, want the rejected key to leave it alone", got)
+	}
+
+	if err := writeUnified(fs, fs.root+"/ctr", map[string]string{"memory.oom.group": "1"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.read(t, "/ctr", "memory.oom.group"); got != "1" {
+		t.Errorf("memory.oom.group = %q, want 1", got)
+	}
+	if err := writeUnified(fs, fs.root+"/ctr", map[string]string{"memory.bogus": "1"}, false); err == nil {
+		t.Error("writeUnified with a file the kernel lacks succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(fs.root, "ctr", "memory.bogus")); !os.IsNotExist(err) {
+		t.Errorf("memory.bogus was created: %v", err)
+	}
+}
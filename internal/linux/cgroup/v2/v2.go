@@ -1,23 +1,78 @@
 package cgroup
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
-// CgroupManager manages the cgroups for a container.
+// Manager creates and configures the cgroup of a container.
+type Manager interface {
+	// SetUnified sets the raw cgroup file values from linux.resources.unified.
+	SetUnified(values map[string]string)
+	// SetBestEffort makes Setup skip, with a warning, the subsystems whose
+	// controller is not available instead of failing.
+	SetBestEffort(bestEffort bool)
+	// Setup prepares the cgroup before the container process is started.
+	Setup() error
+	// Path returns the path of the container cgroup.
+	Path() string
+	// AddProcess moves a process into the container cgroup.
+	AddProcess(pid int) error
+	// Stats reads the statistics of every configured subsystem.
+	Stats() (*Stats, error)
+	// Kill kills every process in the container cgroup and waits until it is empty.
+	Kill() error
+	// Clean removes the container cgroup.
+	Clean() error
+}
+
+// DefaultRoot is the mount point of the cgroup v2 hierarchy.
+const DefaultRoot = "/sys/fs/cgroup"
+
+// CgroupManager manages the cgroups for a container by writing to the cgroup
+// filesystem directly.
 type CgroupManager struct {
-	root          string
-	containerName string
-	subsystems    []SubSystem
+	fs         FileSystem
+	root       string
+	path       string
+	subsystems []SubSystem
+	unified    map[string]string
+	bestEffort bool
+}
+
+// implementedSubsystems holds a value of every subsystem the runtime implements.
+var implementedSubsystems = []SubSystem{
+	&CPUSubSystem{},
+	&CpusetSubSystem{},
+	&MemorySubSystem{},
+	&PidsSubSystem{},
+	&IOSubSystem{},
+	&HugepageSubSystem{},
+	&RDMASubsystem{},
+	&MiscSubSystem{},
+}
+
+// Controllers returns the cgroup v2 controllers the runtime has subsystems for.
+func Controllers() []string {
+	controllers := make([]string, 0, len(implementedSubsystems))
+	for _, s := range implementedSubsystems {
+		controllers = append(controllers, s.Name())
+	}
+	return controllers
 }
 
 // SubSystem represents a cgroup v2 controller.
 type SubSystem interface {
 	Name() string
-	Setup(path string) error
+	// Apply writes the configured knobs to the cgroup at path in fs. Knobs that
+	// are not set are left at their current value, and read-only files are never written.
+	Apply(fs FileSystem, path string) error
+	// Stat reads the controller's statistics from the cgroup at path in fs into stats.
+	Stat(fs FileSystem, path string, stats *Stats) error
 }
 
 // CgroupFile represents a cgroup file and the value to be written to it.
@@ -26,51 +81,220 @@ type CgroupFile struct {
 	Value    string
 }
 
-// NewCgroupManager creates a new CgroupManager for a given container name.
-func NewCgroupManager(containerName string, subsystems []SubSystem) *CgroupManager {
+// FileSystem gives access to the cgroup hierarchy. Managers use the host's
+// cgroup filesystem by default; tests set one that emulates the kernel's.
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	ReadDir(name string) ([]os.DirEntry, error)
+	Stat(name string) (os.FileInfo, error)
+	WriteFile(name, value string) error
+	MkdirAll(path string) error
+}
+
+// OSFileSystem is the FileSystem of the host.
+type OSFileSystem struct{}
+
+func (OSFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (OSFileSystem) ReadDir(name string) ([]os.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (OSFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFileSystem) WriteFile(name, value string) error {
+	return os.WriteFile(name, []byte(value), 0o600)
+}
+
+func (OSFileSystem) MkdirAll(path string) error {
+	return os.MkdirAll(path, 0o755)
+}
+
+// NewCgroupManager creates a new CgroupManager for the cgroup at path,
+// relative to the cgroup root. Use ResolvePath to obtain it from a spec.
+func NewCgroupManager(path string, subsystems []SubSystem) *CgroupManager {
 	return &CgroupManager{
-		root:          "/sys/fs/cgroup",
-		containerName: containerName,
-		subsystems:    subsystems,
+		fs:         OSFileSystem{},
+		root:       DefaultRoot,
+		path:       path,
+		subsystems: subsystems,
+	}
+}
+
+// ResolvePath resolves an OCI linux.cgroupsPath to a path relative to the
+// cgroup root. An empty cgroupsPath places the container directly below the
+// root, and a relative one is resolved against the runtime's own cgroup.
+func ResolvePath(cgroupsPath, containerID string) (string, error) {
+	var path string
+	switch {
+	case cgroupsPath == "":
+		path = "/" + containerID
+	case strings.Count(cgroupsPath, ":") == 2:
+		return "", fmt.Errorf("cgroup: cgroups path %q has the systemd slice:prefix:name form, which requires the systemd cgroup driver", cgroupsPath)
+	case filepath.IsAbs(cgroupsPath):
+		path = filepath.Clean(cgroupsPath)
+	default:
+		own, err := ownCgroup()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(own, cgroupsPath)
+	}
+
+	if path == "/" {
+		return "", fmt.Errorf("cgroup: cgroups path %q resolves to the cgroup root", cgroupsPath)
+	}
+	return path, nil
+}
+
+// procSelfCgroup lists the cgroups of the calling process.
+var procSelfCgroup = "/proc/self/cgroup"
+
+// ownCgroup returns the cgroup of the calling process.
+func ownCgroup() (string, error) {
+	content, err := os.ReadFile(procSelfCgroup)
+	if err != nil {
+		return "", fmt.Errorf("cgroup: failed to read own cgroup: %w", err)
+	}
+	return parseOwnCgroup(string(content))
+}
+
+// parseOwnCgroup finds the cgroup of a process in the content of its
+// /proc/<pid>/cgroup file. With cgroup v1 controllers, as on a legacy or
+// hybrid host, the runtime manages their hierarchies, so the process must be
+// in the same cgroup in every one of them. Otherwise the "0::" line of the
+// cgroup v2 hierarchy is used.
+func parseOwnCgroup(content string) (string, error) {
+	var unified, v1Path, v1Controllers string
+	hasUnified := false
+	for _, line := range strings.Split(content, "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		controllers, path := fields[1], fields[2]
+		switch {
+		case fields[0] == "0" && controllers == "":
+			unified, hasUnified = path, true
+		case controllers == "" || strings.HasPrefix(controllers, "name="):
+			// Named hierarchies, such as systemd's, have no controllers.
+		case v1Controllers == "":
+			v1Path, v1Controllers = path, controllers
+		case path != v1Path:
+			return "", fmt.Errorf("cgroup: the runtime is in cgroup %s for %s but in %s for %s; use an absolute cgroups path",
+				v1Path, v1Controllers, path, controllers)
+		}
+	}
+
+	if v1Controllers != "" {
+		return v1Path, nil
 	}
+	if hasUnified {
+		return unified, nil
+	}
+	return "", errors.New("cgroup: no cgroup found in /proc/self/cgroup")
+}
+
+// SetRoot sets the mount point of the cgroup hierarchy, DefaultRoot by default.
+func (m *CgroupManager) SetRoot(root string) {
+	m.root = root
+}
+
+// SetFileSystem sets the filesystem the cgroup hierarchy is accessed
+// through, OSFileSystem by default.
+func (m *CgroupManager) SetFileSystem(fs FileSystem) {
+	m.fs = fs
+}
+
+// SetUnified sets the raw cgroup file values from linux.resources.unified.
+// They are written after all subsystems, so they take precedence.
+func (m *CgroupManager) SetUnified(values map[string]string) {
+	m.unified = values
+}
+
+// SetBestEffort makes Setup skip, with a warning, the subsystems whose
+// controller is not available instead of failing.
+func (m *CgroupManager) SetBestEffort(bestEffort bool) {
+	m.bestEffort = bestEffort
 }
 
 // Setup creates the cgroup hierarchy and configures all subsystems.
+// Every missing level of the path is created, and the subsystems' controllers
+// are enabled in the cgroup.subtree_control of the ancestors, starting from
+// the nearest one that lists them in its cgroup.controllers.
 func (m *CgroupManager) Setup() error {
-	containerCgroup := filepath.Join(m.root, m.containerName)
-	if err := os.Mkdir(containerCgroup, 0o750); err != nil && !os.IsExist(err) {
-		return fmt.Errorf("cgroup: failed to create container cgroup: %w", err)
+	containerCgroup := m.Path()
+
+	subsystems, err := availableSubsystems(m.fs, containerCgroup, m.subsystems, m.bestEffort)
+	if err != nil {
+		return err
 	}
+	m.subsystems = subsystems
 
-	var controllers []string
-	for _, s := range m.subsystems {
-		controllers = append(controllers, "+"+s.Name())
+	if err := m.fs.MkdirAll(containerCgroup); err != nil {
+		return fmt.Errorf("cgroup: failed to create cgroup %s: %w", containerCgroup, err)
 	}
-	if len(controllers) > 0 {
-		ctrl := []byte(strings.Join(controllers, " "))
-		if err := os.WriteFile(filepath.Join(containerCgroup, "cgroup.subtree_control"), ctrl, 0o600); err != nil {
-			return fmt.Errorf("cgroup: failed to set controllers: %w", err)
+
+	for _, s := range m.subsystems {
+		if err := enableControllerInAncestors(m.fs, containerCgroup, s.Name()); err != nil {
+			return fmt.Errorf("cgroup: %w", err)
 		}
 	}
 
 	for _, s := range m.subsystems {
-		if err := s.Setup(containerCgroup); err != nil {
-			return fmt.Errorf("cgroup: subsystem %s setup failed: %w", s.Name(), err)
+		if err := s.Apply(m.fs, containerCgroup); err != nil {
+			return fmt.Errorf("cgroup: subsystem %s apply failed: %w", s.Name(), err)
 		}
 	}
+
+	if err := writeUnified(m.fs, containerCgroup, m.unified, m.bestEffort); err != nil {
+		return err
+	}
 	return nil
 }
 
-// Clean removes the cgroup hierarchy and cleans up all subsystems.
-func (m *CgroupManager) Clean() error {
-	containerCgroup := filepath.Join(m.root, m.containerName)
-	if err := os.Remove(containerCgroup); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("cgroup: failed to remove container cgroup: %w", err)
+// Path returns the path of the container cgroup.
+func (m *CgroupManager) Path() string {
+	return filepath.Join(m.root, m.path)
+}
+
+// AddProcess moves a process into the container cgroup.
+func (m *CgroupManager) AddProcess(pid int) error {
+	if err := writeCgroupFile(m.fs, m.Path(), "cgroup.procs", strconv.Itoa(pid)); err != nil {
+		return fmt.Errorf("cgroup: failed to add process %d to cgroup: %w", pid, err)
 	}
 	return nil
 }
 
+// Stats reads the statistics of every configured subsystem.
+func (m *CgroupManager) Stats() (*Stats, error) {
+	return collectStats(m.fs, m.Path(), m.subsystems)
+}
+
+// Kill kills every process in the container cgroup and waits until it is empty.
+func (m *CgroupManager) Kill() error {
+	return killCgroup(m.fs, m.Path())
+}
+
+// Clean removes the container cgroup together with any cgroups created below it.
+func (m *CgroupManager) Clean() error {
+	return RemoveTree(m.Path())
+}
+
+// formatLimit formats a limit value, using "max" for negative (unlimited) values.
+func formatLimit(value int64) string {
+	if value < 0 {
+		return "max"
+	}
+	return strconv.FormatInt(value, 10)
+}
+
 // writeCgroupFile writes a value to a cgroup file.
-func writeCgroupFile(path, filename, value string) error {
-	return os.WriteFile(filepath.Join(path, filename), []byte(value), 0o600)
+func writeCgroupFile(fs FileSystem, path, filename, value string) error {
+	return fs.WriteFile(filepath.Join(path, filename), value)
 }
@@ -0,0 +1,220 @@
+package cgroup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestCgroupManagerSetupOnFakeCgroupFS(t *testing.T) {
+	fs := newFakeCgroupFS(t, "cpuset", "cpu", "io", "memory", "hugetlb", "pids", "rdma")
+
+	memMax, memHigh := int64(256<<20), int64(192<<20)
+	pids := int64(64)
+	quota, period, weight := int64(50000), uint64(100000), uint64(200)
+	ioWeight := uint64(300)
+	hugepages := uint64(4 << 20)
+	rdmaHandles := uint32(8)
+	m := NewCgroupManager("/tenant/ctr", []SubSystem{
+		&CpusetSubSystem{Cpus: "0-1", Mems: "0"},
+		&CPUSubSystem{Quota: &quota, Period: &period, Weight: &weight},
+		&IOSubSystem{Weight: &ioWeight},
+		&MemorySubSystem{Max: &memMax, High: &memHigh},
+		&HugepageSubSystem{Limits: map[string]HugepageLimit{"2MB": {Max: &hugepages, RsvdMax: &hugepages}}},
+		&PidsSubSystem{MaxPids: &pids},
+		&RDMASubsystem{Limits: map[string]RDMALimit{"mlx5_0": {HCAHandles: &rdmaHandles}}},
+	})
+	m.SetRoot(fs.root)
+	m.SetFileSystem(fs)
+	m.SetUnified(map[string]string{"memory.oom.group": "1"})
+	if err := m.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	all := "cpuset cpu io memory hugetlb pids rdma"
+	for _, path := range []string{"/", "/tenant"} {
+		if got := fs.read(t, path, "cgroup.subtree_control"); got != all {
+			t.Errorf("%s cgroup.subtree_control = %q, want %q", path, got, all)
+		}
+	}
+	for file, want := range map[string]string{
+		"cgroup.controllers":   all,
+		"cpuset.cpus":          "0-1",
+		"cpu.max":              "50000 100000",
+		"cpu.weight":           "200",
+		"io.weight":            "default 300",
+		"memory.max":           "268435456",
+		"memory.high":          "201326592",
+		"memory.low":           "0",
+		"memory.oom.group":     "1",
+		"hugetlb.2MB.max":      "4194304",
+		"hugetlb.2MB.rsvd.max": "4194304",
+		"pids.max":             "64",
+		"rdma.max":             "mlx5_0 hca_handle=8 hca_object=max",
+	} {
+		if got := fs.read(t, "/tenant/ctr", file); got != want {
+			t.Errorf("%s = %q, want %q", file, got, want)
+		}
+	}
+
+	fs.set(t, "/tenant/ctr", "memory.current", "4096\n")
+	fs.set(t, "/tenant/ctr", "pids.current", "3\n")
+	fs.set(t, "/tenant/ctr", "io.stat", "8:0 rbytes=512 wbytes=1024 rios=1 wios=2 dbytes=0 dios=0\n")
+	fs.set(t, "/tenant/ctr", "hugetlb.2MB.current", "2097152\n")
+	fs.set(t, "/tenant/ctr", "rdma.current", "mlx5_0 hca_handle=1 hca_object=4\n")
+	stats, err := m.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Cpuset.CpusEffective != "0-3" || stats.Memory.Current != 4096 || stats.Pids.Current != 3 {
+		t.Errorf("stats = cpuset %+v, memory %+v, pids %+v", stats.Cpuset, stats.Memory, stats.Pids)
+	}
+	wantIO := []IOStat{{Device: IODevice{Major: 8}, RBytes: 512, WBytes: 1024, RIOs: 1, WIOs: 2}}
+	if !reflect.DeepEqual(stats.IO, wantIO) {
+		t.Errorf("io stats = %+v, want %+v", stats.IO, wantIO)
+	}
+	if got := stats.Hugetlb["2MB"].Current; got != 2<<20 {
+		t.Errorf("hugetlb 2MB usage = %d, want %d", got, 2<<20)
+	}
+	if got := stats.RDMA["mlx5_0"]; got != (RDMAHCA{HCAHandle: 1, HCAObject: 4}) {
+		t.Errorf("rdma usage = %+v", got)
+	}
+}
+
+func TestCgroupManagerSetupRejectsInvalidValues(t *testing.T) {
+	fs := newFakeCgroupFS(t, "cpu", "memory")
+
+	weight := uint64(0)
+	m := NewCgroupManager("/ctr", []SubSystem{&CPUSubSystem{Weight: &weight}})
+	m.SetRoot(fs.root)
+	m.SetFileSystem(fs)
+	if err := m.Setup(); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("Setup with cpu.weight 0 = %v, want EINVAL", err)
+	}
+
+	m = NewCgroupManager("/ctr", nil)
+	m.SetRoot(fs.root)
+	m.SetFileSystem(fs)
+	m.SetUnified(map[string]string{"memory.current": "1"})
+	if err := m.Setup(); !errors.Is(err, syscall.EACCES) {
+		t.Errorf("Setup writing memory.current = %v, want EACCES", err)
+	}
+}
+
+func TestFakeCgroupFSSubtreeControl(t *testing.T) {
+	fs := newFakeCgroupFS(t, "cpu", "memory")
+	if err := fs.MkdirAll(fs.root + "/a/b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeCgroupFile(fs, fs.root, "cgroup.subtree_control", "+io"); !errors.Is(err, syscall.ENOENT) {
+		t.Errorf("enabling an unavailable controller = %v, want ENOENT", err)
+	}
+	if err := writeCgroupFile(fs, fs.root, "cgroup.subtree_control", "+memory"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCgroupFile(fs, fs.root+"/a", "cgroup.subtree_control", "+memory"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.read(t, "/a/b", "memory.max"); got != "max" {
+		t.Errorf("/a/b memory.max = %q, want max", got)
+	}
+	if err := writeCgroupFile(fs, fs.root, "cgroup.subtree_control", "-memory"); !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("disabling a controller used by a child = %v, want EBUSY", err)
+	}
+	if err := writeCgroupFile(fs, fs.root+"/a", "cgroup.subtree_control", "-memory"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.read(t, "/a/b", "cgroup.controllers"); got != "" {
+		t.Errorf("/a/b cgroup.controllers = %q after disabling memory, want none", got)
+	}
+	if err := writeCgroupFile(fs, fs.root+"/a/b", "memory.max", "1"); !errors.Is(err, syscall.EACCES) {
+		t.Errorf("writing the file of a disabled controller = %v, want EACCES", err)
+	}
+}
+
+func TestParseOwnCgroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "unified",
+			content: "0::/user.slice/user-1000.slice/session-2.scope\n",
+			want:    "/user.slice/user-1000.slice/session-2.scope",
+		},
+		{
+			name:    "legacy",
+			content: "12:pids:/ci\n11:cpu,cpuacct:/ci\n4:memory:/ci\n1:name=systemd:/system.slice/ci.service\n",
+			want:    "/ci",
+		},
+		{
+			name:    "hybrid uses the v1 hierarchies",
+			content: "9:name=systemd:/\n8:pids:/ci\n4:memory:/ci\n1:cpu:/ci\n0::/system.slice/ci.service\n",
+			want:    "/ci",
+		},
+		{
+			name:    "named hierarchies only",
+			content: "1:name=systemd:/init.scope\n0::/init.scope\n",
+			want:    "/init.scope",
+		},
+		{
+			name:    "different v1 cgroups",
+			content: "8:pids:/\n4:memory:/limited\n0::/\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			content: "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseOwnCgroup(tt.content)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: parseOwnCgroup() = %q, %v, want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	procCgroup := filepath.Join(t.TempDir(), "cgroup")
+	if err := os.WriteFile(procCgroup, []byte("0::/runtime.slice/ctr.scope\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	previous := procSelfCgroup
+	procSelfCgroup = procCgroup
+	t.Cleanup(func() { procSelfCgroup = previous })
+
+	tests := []struct {
+		cgroupsPath string
+		want        string
+		wantErr     bool
+	}{
+		{"", "/abc", false},
+		{"/tenant/abc", "/tenant/abc", false},
+		{"/tenant/../abc/", "/abc", false},
+		{"tenant/abc", "/runtime.slice/ctr.scope/tenant/abc", false},
+		{"../abc", "/runtime.slice/abc", false},
+		{"machine.slice:ctr:abc", "", true},
+		{":ctr:abc", "", true},
+		{"/", "", true},
+		{"/tenant/..", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ResolvePath(tt.cgroupsPath, "abc")
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolvePath(%q) = %q, %v, want %q, error %v", tt.cgroupsPath, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	procSelfCgroup = filepath.Join(t.TempDir(), "missing")
+	if _, err := ResolvePath("tenant/abc", "abc"); err == nil {
+		t.Error("ResolvePath with a relative path succeeded without /proc/self/cgroup")
+	}
+}
@@ -0,0 +1,84 @@
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileWatcher waits for modifications of a set of files using inotify.
+type fileWatcher struct {
+	inotifyFd int
+	epollFd   int
+}
+
+func newFileWatcher(files ...string) (*fileWatcher, error) {
+	inotifyFd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+	w := &fileWatcher{inotifyFd: inotifyFd, epollFd: -1}
+
+	for _, file := range files {
+		if _, err := syscall.InotifyAddWatch(inotifyFd, file, syscall.IN_MODIFY); err != nil {
+			w.Close()
+			return nil, fmt.Errorf("failed to watch %s: %w", file, err)
+		}
+	}
+
+	w.epollFd, err = syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		w.Close()
+		return nil, fmt.Errorf("failed to create epoll instance: %w", err)
+	}
+	event := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(inotifyFd)}
+	if err := syscall.EpollCtl(w.epollFd, syscall.EPOLL_CTL_ADD, inotifyFd, &event); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("failed to add inotify to epoll: %w", err)
+	}
+	return w, nil
+}
+
+// Wait blocks until one of the files is modified or timeout passes. It does not
+// report which file changed, so callers re-read the files they care about.
+// A timeout is not an error.
+func (w *fileWatcher) Wait(timeout time.Duration) error {
+	events := make([]syscall.EpollEvent, 1)
+	for {
+		_, err := syscall.EpollWait(w.epollFd, events, int(timeout.Milliseconds())+1)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to wait for file events: %w", err)
+		}
+		break
+	}
+	return w.drain()
+}
+
+// drain discards the queued inotify events.
+func (w *fileWatcher) drain() error {
+	buf := make([]byte, 4096)
+	for {
+		_, err := syscall.Read(w.inotifyFd, buf)
+		if errors.Is(err, syscall.EAGAIN) {
+			return nil
+		}
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read inotify events: %w", err)
+		}
+	}
+}
+
+func (w *fileWatcher) Close() error {
+	if w.epollFd >= 0 {
+		_ = syscall.Close(w.epollFd)
+	}
+	return os.NewSyscallError("close", syscall.Close(w.inotifyFd))
+}
@@ -0,0 +1,72 @@
+package timens
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Clocks lists the clocks whose offsets can be set in a time namespace.
+var Clocks = []string{"monotonic", "boottime"}
+
+// Unshare creates a new time namespace for the children of the calling thread
+// and writes the given offsets to it. The calling thread itself stays in its
+// current time namespace and only enters the new one on its next execve.
+//
+// The namespace is tracked per thread while the offsets file is per process,
+// so Unshare must be called from the main thread locked with runtime.LockOSThread.
+func Unshare(offsets map[string]specs.LinuxTimeOffset) error {
+	content, err := FormatOffsets(offsets)
+	if err != nil {
+		return err
+	}
+
+	if err := syscall.Unshare(syscall.CLONE_NEWTIME); err != nil {
+		return fmt.Errorf("timens: failed to unshare time namespace: %w", err)
+	}
+
+	if len(content) == 0 {
+		return nil
+	}
+
+	// Offsets can only be written while no process has entered the namespace.
+	if err := os.WriteFile("/proc/self/timens_offsets", content, 0o600); err != nil {
+		return fmt.Errorf("timens: failed to write time namespace offsets: %w", err)
+	}
+	return nil
+}
+
+// FormatOffsets renders offsets in the format expected by /proc/<pid>/timens_offsets.
+func FormatOffsets(offsets map[string]specs.LinuxTimeOffset) ([]byte, error) {
+	clocks := make([]string, 0, len(offsets))
+	for clock := range offsets {
+		if !isSupportedClock(clock) {
+			return nil, fmt.Errorf("timens: unsupported clock %q", clock)
+		}
+		clocks = append(clocks, clock)
+	}
+	sort.Strings(clocks)
+
+	var b strings.Builder
+	for _, clock := range clocks {
+		offset := offsets[clock]
+		if offset.Nanosecs >= 1_000_000_000 {
+			return nil, fmt.Errorf("timens: nanosecs for clock %s must be less than one second", clock)
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", clock, offset.Secs, offset.Nanosecs)
+	}
+	return []byte(b.String()), nil
+}
+
+func isSupportedClock(clock string) bool {
+	for _, c := range Clocks {
+		if c == clock {
+			return true
+		}
+	}
+	return false
+}
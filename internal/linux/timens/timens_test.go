@@ -0,0 +1,81 @@
+package timens
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestFormatOffsets(t *testing.T) {
+	tests := []struct {
+		name    string
+		offsets map[string]specs.LinuxTimeOffset
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			offsets: map[string]specs.LinuxTimeOffset{},
+			want:    "",
+		},
+		{
+			name:    "nil",
+			offsets: nil,
+			want:    "",
+		},
+		{
+			name:    "monotonic",
+			offsets: map[string]specs.LinuxTimeOffset{"monotonic": {Secs: 10, Nanosecs: 500}},
+			want:    "monotonic 10 500\n",
+		},
+		{
+			name:    "negative boottime",
+			offsets: map[string]specs.LinuxTimeOffset{"boottime": {Secs: -3600}},
+			want:    "boottime -3600 0\n",
+		},
+		{
+			name: "both clocks are sorted",
+			offsets: map[string]specs.LinuxTimeOffset{
+				"monotonic": {Secs: 1, Nanosecs: 2},
+				"boottime":  {Secs: 3, Nanosecs: 999_999_999},
+			},
+			want: "boottime 3 999999999\nmonotonic 1 2\n",
+		},
+		{
+			name:    "unknown clock",
+			offsets: map[string]specs.LinuxTimeOffset{"realtime": {Secs: 1}},
+			wantErr: true,
+		},
+		{
+			name: "unknown clock among known ones",
+			offsets: map[string]specs.LinuxTimeOffset{
+				"monotonic": {Secs: 1},
+				"tai":       {Secs: 1},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "nanosecs of a full second",
+			offsets: map[string]specs.LinuxTimeOffset{"monotonic": {Nanosecs: 1_000_000_000}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatOffsets(tt.offsets)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("FormatOffsets() = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FormatOffsets() failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("FormatOffsets() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -14,8 +14,8 @@ if [[ ! -x "${RUNTIME}" ]]; then
   exit 1
 fi
 
-if [[ ! -f "${BUNDLE_DIR}/config-stress.json" ]]; then
-  echo "stress config not found: ${BUNDLE_DIR}/config-stress.json" >&2
+if [[ ! -d "${BUNDLE_DIR}/stressfs" ]]; then
+  echo "stress rootfs not found: ${BUNDLE_DIR}/stressfs" >&2
   echo "run 'make setup-stress' first" >&2
   exit 1
 fi